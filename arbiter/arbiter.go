@@ -0,0 +1,230 @@
+package arbiter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dasfoo/i2c"
+)
+
+// Stats of the transactions with a single device
+type Stats struct {
+	Transactions uint64
+	Errors       uint64
+	// Latency is the total time spent in transactions, not including waiting for the bus
+	Latency time.Duration
+	// MaxLatency is the longest transaction
+	MaxLatency time.Duration
+	// Wait is the total time spent waiting for the bus
+	Wait time.Duration
+}
+
+// Arbiter serializes transactions on the bus shared by multiple devices and goroutines.
+// Use Bus, Urgent and Session to access the bus.
+type Arbiter struct {
+	bus i2c.Bus
+
+	mu       sync.Mutex
+	busy     bool
+	urgent   []chan struct{}
+	normal   []chan struct{}
+	sessions map[byte]*sync.Mutex
+	stats    map[byte]*Stats
+}
+
+// NewArbiter takes ownership of the bus; it must not be used directly anymore
+func NewArbiter(bus i2c.Bus) *Arbiter {
+	return &Arbiter{
+		bus:      bus,
+		sessions: make(map[byte]*sync.Mutex),
+		stats:    make(map[byte]*Stats),
+	}
+}
+
+// acquire waits for the bus, letting urgent waiters through first
+func (a *Arbiter) acquire(urgent bool) {
+	a.mu.Lock()
+	if !a.busy {
+		a.busy = true
+		a.mu.Unlock()
+		return
+	}
+	turn := make(chan struct{})
+	if urgent {
+		a.urgent = append(a.urgent, turn)
+	} else {
+		a.normal = append(a.normal, turn)
+	}
+	a.mu.Unlock()
+	<-turn
+}
+
+// release hands the bus over to the next waiter
+func (a *Arbiter) release() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var next chan struct{}
+	if len(a.urgent) > 0 {
+		next, a.urgent = a.urgent[0], a.urgent[1:]
+	} else if len(a.normal) > 0 {
+		next, a.normal = a.normal[0], a.normal[1:]
+	} else {
+		a.busy = false
+		return
+	}
+	close(next)
+}
+
+func (a *Arbiter) session(addr byte) *sync.Mutex {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s, ok := a.sessions[addr]
+	if !ok {
+		s = &sync.Mutex{}
+		a.sessions[addr] = s
+	}
+	return s
+}
+
+// transaction runs op on the bus exclusively and records stats for addr
+func (a *Arbiter) transaction(addr byte, urgent bool, op func() error) error {
+	started := time.Now()
+	a.acquire(urgent)
+	acquired := time.Now()
+	err := op()
+	latency := time.Since(acquired)
+	a.release()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	stats, ok := a.stats[addr]
+	if !ok {
+		stats = &Stats{}
+		a.stats[addr] = stats
+	}
+	stats.Transactions++
+	if err != nil {
+		stats.Errors++
+	}
+	stats.Latency += latency
+	if latency > stats.MaxLatency {
+		stats.MaxLatency = latency
+	}
+	stats.Wait += acquired.Sub(started)
+	return err
+}
+
+// Stats returns a copy of the stats for every device address used so far
+func (a *Arbiter) Stats() map[byte]Stats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	stats := make(map[byte]Stats, len(a.stats))
+	for addr, s := range a.stats {
+		stats[addr] = *s
+	}
+	return stats
+}
+
+// Bus returns i2c.Bus, transactions on which are serialized with the other users
+func (a *Arbiter) Bus() i2c.Bus {
+	return &view{arbiter: a}
+}
+
+// Session runs fn with exclusive access to the device at addr: transactions to addr from
+// outside of fn wait until fn returns. Transactions to other devices are not blocked.
+// fn must only use the bus it is given to access addr, otherwise it deadlocks.
+func (a *Arbiter) Session(addr byte, fn func(bus i2c.Bus) error) error {
+	s := a.session(addr)
+	s.Lock()
+	defer s.Unlock()
+	return fn(&view{arbiter: a, inSession: true, session: addr})
+}
+
+// Urgent returns i2c.Bus, transactions on which go before the ones waiting for the bus,
+// and don't wait for sessions. It is meant for safety commands, like stopping the motors.
+func (a *Arbiter) Urgent() i2c.Bus {
+	return &view{arbiter: a, urgent: true}
+}
+
+// view is an i2c.Bus which sends transactions through the arbiter
+type view struct {
+	arbiter   *Arbiter
+	urgent    bool
+	inSession bool
+	// session is the address of the device this view has exclusive access to
+	session byte
+}
+
+func (v *view) do(addr byte, op func() error) error {
+	if !v.urgent && !(v.inSession && addr == v.session) {
+		s := v.arbiter.session(addr)
+		s.Lock()
+		defer s.Unlock()
+	}
+	return v.arbiter.transaction(addr, v.urgent, op)
+}
+
+// Session is the same as Arbiter.Session, so that devices can use it through i2c.Bus
+func (v *view) Session(addr byte, fn func(bus i2c.Bus) error) error {
+	if v.inSession && addr == v.session {
+		return fn(v)
+	}
+	return v.arbiter.Session(addr, fn)
+}
+
+// Urgent is the same as Arbiter.Urgent, so that devices can use it through i2c.Bus
+func (v *view) Urgent() i2c.Bus {
+	return v.arbiter.Urgent()
+}
+
+func (v *view) SetLogger(logf func(string, ...interface{})) {
+	v.arbiter.bus.SetLogger(logf)
+}
+
+func (v *view) ReadByteFromReg(addr, reg byte) (value byte, err error) {
+	err = v.do(addr, func() (e error) {
+		value, e = v.arbiter.bus.ReadByteFromReg(addr, reg)
+		return
+	})
+	return
+}
+
+func (v *view) ReadWordFromReg(addr, reg byte) (value uint16, err error) {
+	err = v.do(addr, func() (e error) {
+		value, e = v.arbiter.bus.ReadWordFromReg(addr, reg)
+		return
+	})
+	return
+}
+
+func (v *view) ReadSliceFromReg(addr, reg byte, data []byte) (n int, err error) {
+	err = v.do(addr, func() (e error) {
+		n, e = v.arbiter.bus.ReadSliceFromReg(addr, reg, data)
+		return
+	})
+	return
+}
+
+func (v *view) WriteByteToReg(addr, reg, value byte) error {
+	return v.do(addr, func() error {
+		return v.arbiter.bus.WriteByteToReg(addr, reg, value)
+	})
+}
+
+func (v *view) WriteWordToReg(addr, reg byte, value uint16) error {
+	return v.do(addr, func() error {
+		return v.arbiter.bus.WriteWordToReg(addr, reg, value)
+	})
+}
+
+func (v *view) WriteSliceToReg(addr, reg byte, data []byte) (n int, err error) {
+	err = v.do(addr, func() (e error) {
+		n, e = v.arbiter.bus.WriteSliceToReg(addr, reg, data)
+		return
+	})
+	return
+}
+
+func (v *view) Close() error {
+	return v.arbiter.bus.Close()
+}
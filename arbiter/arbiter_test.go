@@ -0,0 +1,204 @@
+package arbiter
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dasfoo/i2c"
+)
+
+var errWrite = errors.New("write failed")
+
+// fakeBus records the order of writes, and fails on concurrent access
+type fakeBus struct {
+	i2c.Bus
+	t *testing.T
+
+	mu     sync.Mutex
+	active bool
+	writes []byte
+	// block, if set, is waited on by writes of this value
+	block map[byte]chan struct{}
+	// started receives the values as their writes start, unless it's full
+	started   chan byte
+	failValue byte
+}
+
+func newFakeBus(t *testing.T) *fakeBus {
+	return &fakeBus{
+		t:       t,
+		block:   make(map[byte]chan struct{}),
+		started: make(chan byte, 100),
+	}
+}
+
+func (b *fakeBus) WriteByteToReg(addr, reg, value byte) error {
+	b.mu.Lock()
+	if b.active {
+		b.t.Errorf("Concurrent transaction writing %d", value)
+	}
+	b.active = true
+	block := b.block[value]
+	b.mu.Unlock()
+	select {
+	case b.started <- value:
+	default:
+	}
+	if block != nil {
+		<-block
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.active = false
+	b.writes = append(b.writes, value)
+	if value == b.failValue {
+		return errWrite
+	}
+	return nil
+}
+
+func (b *fakeBus) written() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.writes...)
+}
+
+// blockOn makes writes of the value wait until the returned channel is closed
+func (b *fakeBus) blockOn(value byte) chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	release := make(chan struct{})
+	b.block[value] = release
+	return release
+}
+
+// waitStarted waits for the write of value to start on the bus
+func (b *fakeBus) waitStarted(value byte) {
+	for {
+		select {
+		case started := <-b.started:
+			if started == value {
+				return
+			}
+		case <-time.After(time.Second):
+			b.t.Fatalf("Write of %d has not started", value)
+		}
+	}
+}
+
+// write runs the write in background, and returns when it's waiting for the bus
+func write(wg *sync.WaitGroup, bus i2c.Bus, addr, value byte) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_ = bus.WriteByteToReg(addr, 0, value)
+	}()
+	time.Sleep(10 * time.Millisecond)
+}
+
+func TestUrgentFirst(t *testing.T) {
+	bus := newFakeBus(t)
+	a := NewArbiter(bus)
+	var wg sync.WaitGroup
+	release := bus.blockOn(1)
+	write(&wg, a.Bus(), 0x10, 1)
+	bus.waitStarted(1)
+	write(&wg, a.Bus(), 0x11, 2)
+	write(&wg, a.Bus(), 0x12, 3)
+	write(&wg, a.Urgent(), 0x13, 4)
+	write(&wg, a.Urgent(), 0x14, 5)
+	close(release)
+	wg.Wait()
+	if want := []byte{1, 4, 5, 2, 3}; !reflect.DeepEqual(bus.written(), want) {
+		t.Errorf("Transactions went in order %v, want %v", bus.written(), want)
+	}
+}
+
+func TestSession(t *testing.T) {
+	bus := newFakeBus(t)
+	a := NewArbiter(bus)
+	var wg sync.WaitGroup
+	inSession := make(chan struct{})
+	endSession := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := a.Session(0x10, func(session i2c.Bus) error {
+			if err := session.WriteByteToReg(0x10, 0, 1); err != nil {
+				return err
+			}
+			close(inSession)
+			<-endSession
+			return session.WriteByteToReg(0x10, 0, 2)
+		})
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+	<-inSession
+	// Another device and urgent transactions are not blocked by the session
+	write(&wg, a.Bus(), 0x10, 3)
+	if err := a.Bus().WriteByteToReg(0x11, 0, 4); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Urgent().WriteByteToReg(0x10, 0, 5); err != nil {
+		t.Fatal(err)
+	}
+	close(endSession)
+	wg.Wait()
+	if want := []byte{1, 4, 5, 2, 3}; !reflect.DeepEqual(bus.written(), want) {
+		t.Errorf("Transactions went in order %v, want %v", bus.written(), want)
+	}
+}
+
+func TestStats(t *testing.T) {
+	bus := newFakeBus(t)
+	bus.failValue = 3
+	a := NewArbiter(bus)
+	for value := byte(1); value <= 3; value++ {
+		_ = a.Bus().WriteByteToReg(0x10, 0, value)
+	}
+	_ = a.Urgent().WriteByteToReg(0x11, 0, 4)
+	stats := a.Stats()
+	if len(stats) != 2 {
+		t.Fatalf("Stats for %d devices, want 2: %v", len(stats), stats)
+	}
+	if s := stats[0x10]; s.Transactions != 3 || s.Errors != 1 || s.MaxLatency > s.Latency {
+		t.Errorf("Stats of 0x10 = %+v, want 3 transactions with 1 error", s)
+	}
+	if s := stats[0x11]; s.Transactions != 1 || s.Errors != 0 {
+		t.Errorf("Stats of 0x11 = %+v, want 1 transaction", s)
+	}
+}
+
+func TestNoConcurrentTransactions(t *testing.T) {
+	bus := newFakeBus(t)
+	a := NewArbiter(bus)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			view := a.Bus()
+			if i%3 == 0 {
+				view = a.Urgent()
+			}
+			for j := 0; j < 10; j++ {
+				if i%4 == 0 {
+					_ = a.Session(byte(i%5), func(session i2c.Bus) error {
+						return session.WriteByteToReg(byte(i%5), 0, byte(i))
+					})
+				} else {
+					_ = view.WriteByteToReg(byte(i%5), 0, byte(i))
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := len(bus.written()); n != 200 {
+		t.Errorf("%d transactions done, want 200", n)
+	}
+}
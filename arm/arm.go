@@ -0,0 +1,180 @@
+package arm
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/dasfoo/rover/bb"
+)
+
+// StepInterval is how often servos are updated while moving
+const StepInterval = 20 * time.Millisecond
+
+// Pose is a set of angles (degrees, 0..bb.MaxAngle) for all servos of the arm
+type Pose struct {
+	BasePan     byte `json:"base_pan"`
+	BaseTilt    byte `json:"base_tilt"`
+	Elbow       byte `json:"elbow"`
+	WristRotate byte `json:"wrist_rotate"`
+	WristTilt   byte `json:"wrist_tilt"`
+	Grip        byte `json:"grip"`
+}
+
+const joints = 6
+
+func (p Pose) joints() [joints]byte {
+	return [joints]byte{p.BasePan, p.BaseTilt, p.Elbow, p.WristRotate, p.WristTilt, p.Grip}
+}
+
+func poseFromJoints(j [joints]byte) Pose {
+	return Pose{
+		BasePan:     j[0],
+		BaseTilt:    j[1],
+		Elbow:       j[2],
+		WristRotate: j[3],
+		WristTilt:   j[4],
+		Grip:        j[5],
+	}
+}
+
+// Validate returns bb.ErrAngleOutOfRange if any of the angles is out of range
+func (p Pose) Validate() error {
+	for _, angle := range p.joints() {
+		if angle > bb.MaxAngle {
+			return bb.ErrAngleOutOfRange
+		}
+	}
+	return nil
+}
+
+// Servos is the subset of bb.BB controlling the arm
+type Servos interface {
+	ArmBasePan(angle byte) error
+	ArmBaseTilt(angle byte) error
+	ArmElbow(angle byte) error
+	ArmWristRotate(angle byte) error
+	ArmWristTilt(angle byte) error
+	ArmGrip(angle byte) error
+}
+
+// Arm moves all servos of the robotic arm simultaneously and remembers the last pose
+type Arm struct {
+	servos Servos
+
+	mu      sync.Mutex
+	pose    Pose
+	known   bool
+	cancel  context.CancelFunc
+	running sync.Mutex
+}
+
+// NewArm creates an Arm; its pose is unknown until the first move
+func NewArm(servos Servos) *Arm {
+	return &Arm{servos: servos}
+}
+
+// Pose returns the last commanded pose, and whether any pose has been commanded yet
+func (a *Arm) Pose() (Pose, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.pose, a.known
+}
+
+// Stop aborts the move in progress, if any, leaving servos where they are
+func (a *Arm) Stop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.cancel != nil {
+		a.cancel()
+	}
+}
+
+// begin cancels the move in progress and waits for it to finish
+func (a *Arm) begin(ctx context.Context) (context.Context, func()) {
+	a.mu.Lock()
+	if a.cancel != nil {
+		a.cancel()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	a.cancel = cancel
+	a.mu.Unlock()
+
+	a.running.Lock()
+	return ctx, func() {
+		cancel()
+		a.running.Unlock()
+	}
+}
+
+// write sends the angles which differ from the last commanded pose to the servos
+func (a *Arm) write(target [joints]byte) error {
+	a.mu.Lock()
+	current, known := a.pose.joints(), a.known
+	a.mu.Unlock()
+
+	writers := [joints]func(byte) error{
+		a.servos.ArmBasePan,
+		a.servos.ArmBaseTilt,
+		a.servos.ArmElbow,
+		a.servos.ArmWristRotate,
+		a.servos.ArmWristTilt,
+		a.servos.ArmGrip,
+	}
+	for i, write := range writers {
+		if known && current[i] == target[i] {
+			continue
+		}
+		if err := write(target[i]); err != nil {
+			return err
+		}
+		current[i] = target[i]
+		a.mu.Lock()
+		a.pose, a.known = poseFromJoints(current), true
+		a.mu.Unlock()
+	}
+	return nil
+}
+
+// Move interpolates all servos from the last commanded pose to target during duration.
+// If the last pose is unknown, the servos are moved to target at once.
+// Another Move aborts the one in progress.
+func (a *Arm) Move(ctx context.Context, target Pose, duration time.Duration) error {
+	if err := target.Validate(); err != nil {
+		return err
+	}
+	ctx, end := a.begin(ctx)
+	defer end()
+	return a.move(ctx, target, duration)
+}
+
+func (a *Arm) move(ctx context.Context, target Pose, duration time.Duration) error {
+	start, known := a.Pose()
+	if !known || duration <= 0 {
+		return a.write(target.joints())
+	}
+
+	from, to := start.joints(), target.joints()
+	began := time.Now()
+	ticker := time.NewTicker(StepInterval)
+	defer ticker.Stop()
+	for {
+		progress := float64(time.Since(began)) / float64(duration)
+		if progress >= 1 {
+			return a.write(to)
+		}
+		var step [joints]byte
+		for i := range step {
+			step[i] = byte(float64(from[i]) + (float64(to[i])-float64(from[i]))*progress + 0.5)
+		}
+		if err := a.write(step); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
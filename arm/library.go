@@ -0,0 +1,226 @@
+package arm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/dasfoo/rover/internal/atomicfile"
+)
+
+// Error definitions
+var (
+	ErrUnknownPose     = errors.New("No arm pose with such name")
+	ErrUnknownSequence = errors.New("No arm sequence with such name")
+	ErrInvalidName     = errors.New("Name must not be empty")
+)
+
+// Step of a Sequence moves the arm to the named pose during Duration and then waits for Delay
+type Step struct {
+	Pose       string `json:"pose"`
+	DurationMs uint32 `json:"duration_ms"`
+	DelayMs    uint32 `json:"delay_ms"`
+}
+
+// Sequence is a list of steps played one after another
+type Sequence []Step
+
+// DefaultPoses are put into a new Library
+var DefaultPoses = map[string]Pose{
+	"park":  {BasePan: 90, BaseTilt: 160, Elbow: 150, WristRotate: 90, WristTilt: 90, Grip: 0},
+	"reach": {BasePan: 90, BaseTilt: 45, Elbow: 90, WristRotate: 90, WristTilt: 45, Grip: 0},
+	"grab":  {BasePan: 90, BaseTilt: 45, Elbow: 90, WristRotate: 90, WristTilt: 45, Grip: 120},
+	"drop":  {BasePan: 45, BaseTilt: 90, Elbow: 90, WristRotate: 90, WristTilt: 45, Grip: 0},
+}
+
+// DefaultSequences are put into a new Library
+var DefaultSequences = map[string]Sequence{
+	"pick-and-drop": {
+		{Pose: "reach", DurationMs: 1000},
+		{Pose: "grab", DurationMs: 500, DelayMs: 300},
+		{Pose: "drop", DurationMs: 1500, DelayMs: 300},
+		{Pose: "park", DurationMs: 1000},
+	},
+}
+
+// Library is a collection of named poses and sequences, persisted in a JSON file
+type Library struct {
+	filename string
+
+	mu        sync.Mutex
+	poses     map[string]Pose
+	sequences map[string]Sequence
+}
+
+type libraryFile struct {
+	Poses     map[string]Pose     `json:"poses"`
+	Sequences map[string]Sequence `json:"sequences"`
+}
+
+// LoadLibrary reads the library from a file, or creates a new one with default
+// poses and sequences if the file does not exist yet
+func LoadLibrary(filename string) (*Library, error) {
+	l := &Library{
+		filename:  filename,
+		poses:     make(map[string]Pose),
+		sequences: make(map[string]Sequence),
+	}
+	b, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		for name, pose := range DefaultPoses {
+			l.poses[name] = pose
+		}
+		for name, sequence := range DefaultSequences {
+			l.sequences[name] = sequence
+		}
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	f := libraryFile{Poses: l.poses, Sequences: l.sequences}
+	if err = json.Unmarshal(b, &f); err != nil {
+		return nil, err
+	}
+	for name, pose := range l.poses {
+		if err = pose.Validate(); err != nil {
+			return nil, fmt.Errorf("Arm pose %q: %s", name, err)
+		}
+	}
+	for name, sequence := range l.sequences {
+		for _, step := range sequence {
+			if _, ok := l.poses[step.Pose]; !ok {
+				return nil, fmt.Errorf("Arm sequence %q, pose %q: %s", name, step.Pose,
+					ErrUnknownPose)
+			}
+		}
+	}
+	return l, nil
+}
+
+// save writes the library to the file; must be called with mu locked
+func (l *Library) save() error {
+	b, err := json.MarshalIndent(libraryFile{
+		Poses:     l.poses,
+		Sequences: l.sequences,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(l.filename), 0700); err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(l.filename, b)
+}
+
+// Pose returns the pose by name
+func (l *Library) Pose(name string) (Pose, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	pose, ok := l.poses[name]
+	if !ok {
+		return pose, ErrUnknownPose
+	}
+	return pose, nil
+}
+
+// Sequence returns the sequence by name
+func (l *Library) Sequence(name string) (Sequence, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	sequence, ok := l.sequences[name]
+	if !ok {
+		return nil, ErrUnknownSequence
+	}
+	return sequence, nil
+}
+
+// PoseNames returns sorted names of all poses
+func (l *Library) PoseNames() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	names := make([]string, 0, len(l.poses))
+	for name := range l.poses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SequenceNames returns sorted names of all sequences
+func (l *Library) SequenceNames() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	names := make([]string, 0, len(l.sequences))
+	for name := range l.sequences {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SavePose adds or replaces the pose and writes the library to disk
+func (l *Library) SavePose(name string, pose Pose) error {
+	if name == "" {
+		return ErrInvalidName
+	}
+	if err := pose.Validate(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.poses[name] = pose
+	return l.save()
+}
+
+// SaveSequence adds or replaces the sequence and writes the library to disk.
+// All the poses the sequence refers to must exist.
+func (l *Library) SaveSequence(name string, sequence Sequence) error {
+	if name == "" {
+		return ErrInvalidName
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, step := range sequence {
+		if _, ok := l.poses[step.Pose]; !ok {
+			return ErrUnknownPose
+		}
+	}
+	l.sequences[name] = sequence
+	return l.save()
+}
+
+// Play moves the arm through all steps of the sequence from the library.
+// It can be aborted with Stop, another Play or Move.
+func (a *Arm) Play(ctx context.Context, library *Library, name string) error {
+	sequence, err := library.Sequence(name)
+	if err != nil {
+		return err
+	}
+	ctx, end := a.begin(ctx)
+	defer end()
+	for _, step := range sequence {
+		var pose Pose
+		// The pose could have been changed since the sequence was saved
+		if pose, err = library.Pose(step.Pose); err != nil {
+			return err
+		}
+		if err = a.move(ctx, pose, time.Duration(step.DurationMs)*time.Millisecond); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(step.DelayMs) * time.Millisecond):
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package arm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLibrarySaveAndLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "arm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	filename := filepath.Join(dir, "poses", "library.json")
+	l, err := LoadLibrary(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pose := Pose{BasePan: 10, BaseTilt: 20, Elbow: 30, WristRotate: 40, WristTilt: 50, Grip: 60}
+	if err = l.SavePose("wave", pose); err != nil {
+		t.Fatal(err)
+	}
+	if err = l.SaveSequence("hello", Sequence{{Pose: "wave"}, {Pose: "park"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err = l.SaveSequence("bad", Sequence{{Pose: "missing"}}); err != ErrUnknownPose {
+		t.Errorf("SaveSequence with unknown pose = %v, want ErrUnknownPose", err)
+	}
+
+	if l, err = LoadLibrary(filename); err != nil {
+		t.Fatal(err)
+	}
+	if saved, err := l.Pose("wave"); err != nil || saved != pose {
+		t.Errorf("Pose(\"wave\") = %+v, %v, want %+v", saved, err, pose)
+	}
+	if _, err = l.Sequence("hello"); err != nil {
+		t.Error(err)
+	}
+	if files, _ := ioutil.ReadDir(filepath.Dir(filename)); len(files) != 1 {
+		t.Errorf("Temporary files left behind: %d files in the directory", len(files))
+	}
+}
+
+func TestLoadLibraryValidates(t *testing.T) {
+	f, err := ioutil.TempFile("", "arm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+	_ = f.Close()
+	for _, test := range []struct {
+		json string
+		err  string
+	}{
+		{`{"poses": {"up": {"elbow": 90}}, "sequences": {"s": [{"pose": "up"}]}}`, ""},
+		{`{"poses": {"up": {"elbow": 200}}}`, `Arm pose "up"`},
+		{`{"poses": {"up": {}}, "sequences": {"s": [{"pose": "up"}, {"pose": "down"}]}}`,
+			`Arm sequence "s", pose "down"`},
+	} {
+		if err = ioutil.WriteFile(f.Name(), []byte(test.json), 0600); err != nil {
+			t.Fatal(err)
+		}
+		_, err = LoadLibrary(f.Name())
+		if test.err == "" && err != nil {
+			t.Errorf("LoadLibrary(%s) = %v", test.json, err)
+		}
+		if test.err != "" && (err == nil || !strings.HasPrefix(err.Error(), test.err)) {
+			t.Errorf("LoadLibrary(%s) = %v, want %s error", test.json, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	cache "github.com/patrickmn/go-cache"
+)
+
+// Lockout of users and peer addresses guessing tokens
+const (
+	// MaxFailures is the number of incorrect credentials from a peer, or for a user from
+	// the same peer, which triggers the lockout
+	MaxFailures = 5
+	// MaxUserFailures is the number of incorrect tokens for a user from all the peers
+	// together which triggers the lockout of the user
+	MaxUserFailures = 20
+	// FailureWindow is how long a failure is remembered after the last one
+	FailureWindow = 10 * time.Minute
+	// LockoutDuration is how long the access is refused after MaxFailures
+	LockoutDuration = 15 * time.Minute
+	// MaxTrackedFailures limits the number of keys with failures remembered, and the number
+	// of keys locked out, so that the memory use doesn't grow with the number of guesses.
+	// The oldest entries are forgotten first.
+	MaxTrackedFailures = 10000
+)
+
+// ErrLockedOut is returned instead of checking the token after too many failures
+var ErrLockedOut = errors.New("Too many failed attempts, try again later")
+
+// lockout counts recent failures per key, e.g. peer address
+type lockout struct {
+	mu       sync.Mutex
+	failures *cache.Cache
+	locked   *cache.Cache
+}
+
+func newLockout() *lockout {
+	return &lockout{
+		failures: cache.New(FailureWindow, time.Minute),
+		locked:   cache.New(LockoutDuration, time.Minute),
+	}
+}
+
+// check returns ErrLockedOut if any of the keys is locked out
+func (l *lockout) check(keys ...string) error {
+	for _, key := range keys {
+		if _, found := l.locked.Get(key); found {
+			return ErrLockedOut
+		}
+	}
+	return nil
+}
+
+// makeRoom deletes the entry which expires first if the cache is full
+func makeRoom(c *cache.Cache) {
+	if c.ItemCount() < MaxTrackedFailures {
+		return
+	}
+	var (
+		oldest  string
+		expires int64
+	)
+	for key, item := range c.Items() {
+		if oldest == "" || item.Expiration < expires {
+			oldest, expires = key, item.Expiration
+		}
+	}
+	c.Delete(oldest)
+}
+
+// fail counts a failure for the key, and returns true if it got locked out after max failures
+func (l *lockout) fail(key string, max int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	failures := 1
+	if n, found := l.failures.Get(key); found {
+		failures += n.(int)
+	} else {
+		makeRoom(l.failures)
+	}
+	if failures < max {
+		l.failures.Set(key, failures, cache.DefaultExpiration)
+		return false
+	}
+	l.failures.Delete(key)
+	makeRoom(l.locked)
+	l.locked.Set(key, struct{}{}, cache.DefaultExpiration)
+	return true
+}
+
+// reset forgets failures of the key
+func (l *lockout) reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.failures.Delete(key)
+}
+
+// SetAuditLogger sets a function to write the audit log with; log.Printf by default
+func (am *Manager) SetAuditLogger(logf func(string, ...interface{})) {
+	am.auditf = logf
+}
+
+// Audit writes the auth decision to the audit log. Authorize does it already, this is for
+// requests rejected by the caller, e.g. because of the malformed credentials.
+func (am *Manager) Audit(peer, method, user string, level Level, err error) {
+	result := "ok"
+	if err != nil {
+		result = err.Error()
+	}
+	am.auditf("auth: result=%q user=%q peer=%q method=%q level=%q",
+		result, user, peerHost(peer), method, level)
+}
+
+// peerHost strips the port from the peer address, if any
+func peerHost(peer string) string {
+	if host, _, err := net.SplitHostPort(peer); err == nil {
+		return host
+	}
+	return peer
+}
+
+// isLoopback tells whether the host is a loopback address, e.g. of a client connected
+// through the reverse tunnel (bin/reverse-tunnel), which all look the same
+func isLoopback(host string) bool {
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Authorize checks the token with CheckAccess on behalf of the peer (remote address) calling
+// the method (RPC or HTTP path), and writes the decision to the audit log. Access is refused
+// with ErrLockedOut for LockoutDuration:
+//   - to the peer, after MaxFailures unknown user names or incorrect tokens from it,
+//     unless it's a loopback address shared by the tunnelled clients;
+//   - to the user from the peer, after MaxFailures incorrect tokens for the user from it;
+//   - to the user, after MaxUserFailures incorrect tokens for the user from all the peers.
+func (am *Manager) Authorize(peer, method, user, token string, level Level) error {
+	host := peerHost(peer)
+	peerKey := fmt.Sprintf("peer=%q", host)
+	userKey := fmt.Sprintf("user=%q", user)
+	pairKey := fmt.Sprintf("user=%q peer=%q", user, host)
+	keys := []string{userKey, pairKey}
+	if !isLoopback(host) {
+		keys = append(keys, peerKey)
+	}
+	err := am.lockout.check(keys...)
+	if err == nil {
+		err = am.CheckAccess(user, token, level)
+		limits := map[string]int{}
+		switch err {
+		case nil:
+			am.lockout.reset(pairKey)
+		case ErrUnknownUser:
+			// Nobody to lock out but the peer
+			limits[peerKey] = MaxFailures
+		case ErrIncorrectToken:
+			limits[peerKey] = MaxFailures
+			limits[pairKey] = MaxFailures
+			limits[userKey] = MaxUserFailures
+		}
+		for _, key := range keys {
+			if max, ok := limits[key]; ok && am.lockout.fail(key, max) {
+				am.auditf("auth: locked out %s for %q", key, LockoutDuration)
+			}
+		}
+	}
+	am.Audit(peer, method, user, level, err)
+	return err
+}
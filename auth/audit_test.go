@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func newTestManager(backend Backend) (*Manager, *[]string) {
+	am := NewManager(backend)
+	var logged []string
+	am.SetAuditLogger(func(format string, args ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, args...))
+	})
+	return am, &logged
+}
+
+func TestAuditQuotesFields(t *testing.T) {
+	am, logged := newTestManager(mapBackend{})
+	am.Audit("10.0.0.1:1234", "/rover method=x", "bob level=admin", Viewer, nil)
+	want := `auth: result="ok" user="bob level=admin" peer="10.0.0.1" ` +
+		`method="/rover method=x" level="viewer"`
+	if len(*logged) != 1 || (*logged)[0] != want {
+		t.Errorf("Audit log: %q, want %q", *logged, want)
+	}
+}
+
+func TestLockoutByPeer(t *testing.T) {
+	am, _ := newTestManager(mapBackend{"alice": {Token: "secret", Role: Viewer}})
+	for i := 0; i < MaxFailures; i++ {
+		if err := am.Authorize("10.0.0.1:1", "m", fmt.Sprint("guess", i), "x",
+			Viewer); err != ErrUnknownUser {
+			t.Fatalf("Authorize of unknown user = %v, want ErrUnknownUser", err)
+		}
+	}
+	if err := am.Authorize("10.0.0.1:2", "m", "alice", "secret", Viewer); err != ErrLockedOut {
+		t.Errorf("Authorize from the guessing peer = %v, want ErrLockedOut", err)
+	}
+	if err := am.Authorize("10.0.0.2:1", "m", "alice", "secret", Viewer); err != nil {
+		t.Errorf("Unknown user guesses from another peer locked the user out: %v", err)
+	}
+}
+
+func TestLockoutByUserAndPeer(t *testing.T) {
+	am, logged := newTestManager(mapBackend{
+		"alice": {Token: "secret", Role: Viewer},
+		"bob":   {Token: "secret", Role: Viewer},
+	})
+	for i := 0; i < MaxFailures; i++ {
+		// Successful logins of another user must not reset the peer
+		if err := am.Authorize("10.0.0.1:1", "m", "bob", "secret", Viewer); err != nil &&
+			err != ErrLockedOut {
+			t.Fatal(err)
+		}
+		if err := am.Authorize("10.0.0.1:1", "m", "alice", "wrong", Viewer); err !=
+			ErrIncorrectToken {
+			t.Fatalf("Authorize with wrong token = %v, want ErrIncorrectToken", err)
+		}
+	}
+	if err := am.Authorize("10.0.0.1:1", "m", "alice", "secret", Viewer); err != ErrLockedOut {
+		t.Errorf("Authorize after %d failures = %v, want ErrLockedOut", MaxFailures, err)
+	}
+	if err := am.Authorize("10.0.0.2:1", "m", "alice", "secret", Viewer); err != nil {
+		t.Errorf("Failures from another peer locked the user out: %v", err)
+	}
+	found := false
+	for _, line := range *logged {
+		if strings.HasPrefix(line, `auth: locked out user="alice" peer="10.0.0.1"`) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Lockout not logged: %q", *logged)
+	}
+}
+
+func TestLockoutByUser(t *testing.T) {
+	am, _ := newTestManager(mapBackend{"alice": {Token: "secret", Role: Viewer}})
+	for i := 0; i < MaxUserFailures; i++ {
+		peer := fmt.Sprintf("10.0.1.%d:1", i)
+		if err := am.Authorize(peer, "m", "alice", "wrong", Viewer); err != ErrIncorrectToken {
+			t.Fatalf("Authorize with wrong token = %v, want ErrIncorrectToken", err)
+		}
+	}
+	if err := am.Authorize("10.0.2.1:1", "m", "alice", "secret", Viewer); err != ErrLockedOut {
+		t.Errorf("Authorize after %d failures from different peers = %v, want ErrLockedOut",
+			MaxUserFailures, err)
+	}
+}
+
+func TestLockoutExemptsLoopback(t *testing.T) {
+	am, _ := newTestManager(mapBackend{
+		"alice": {Token: "secret", Role: Viewer},
+		"bob":   {Token: "secret", Role: Viewer},
+	})
+	// Clients connected through the reverse tunnel all come from the loopback address
+	for i := 0; i < 2*MaxFailures; i++ {
+		_ = am.Authorize("127.0.0.1:1", "m", fmt.Sprint("guess", i), "x", Viewer)
+		_ = am.Authorize("[::1]:1", "m", "bob", "wrong", Viewer)
+	}
+	if err := am.Authorize("127.0.0.1:2", "m", "alice", "secret", Viewer); err != nil {
+		t.Errorf("Guesses through the tunnel locked out another user: %v", err)
+	}
+	if err := am.Authorize("[::1]:2", "m", "bob", "secret", Viewer); err != ErrLockedOut {
+		t.Errorf("Authorize of the guessed user through the tunnel = %v, want ErrLockedOut",
+			err)
+	}
+}
+
+func TestLockoutWithFullTable(t *testing.T) {
+	am, _ := newTestManager(mapBackend{"alice": {Token: "secret", Role: Viewer}})
+	// Fill the tables with junk from many addresses: locked out ones, then the ones
+	// with a single failure
+	for i := 0; i < 2*(MaxTrackedFailures+10); i++ {
+		peer := fmt.Sprintf("10.%d.%d.%d:1", i>>16&0xff, i>>8&0xff, i&0xff)
+		for j := 0; j < MaxFailures && (j == 0 || i <= MaxTrackedFailures+10); j++ {
+			_ = am.Authorize(peer, "m", "nobody", "x", Viewer)
+		}
+	}
+	if n := am.lockout.failures.ItemCount(); n != MaxTrackedFailures {
+		t.Errorf("%d keys with failures tracked, want the table full", n)
+	}
+	if n := am.lockout.locked.ItemCount(); n != MaxTrackedFailures {
+		t.Errorf("%d keys locked out, want the table full", n)
+	}
+	for i := 0; i < MaxFailures; i++ {
+		_ = am.Authorize("192.168.0.1:1", "m", "alice", "wrong", Viewer)
+	}
+	if err := am.Authorize("192.168.0.1:1", "m", "alice", "secret", Viewer); err !=
+		ErrLockedOut {
+		t.Errorf("Authorize after %d failures with full table = %v, want ErrLockedOut",
+			MaxFailures, err)
+	}
+}
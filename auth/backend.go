@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DefaultRole is given to users whose credential record doesn't have a role
+const DefaultRole = Operator
+
+// Credential of a user, as stored by a Backend. Either Token or Hash is set.
+type Credential struct {
+	// Token in plain text
+	Token string `json:"token,omitempty"`
+	// Hash of the token, bcrypt ("$2a$", "$2b$" or "$2y$" prefix)
+	Hash string `json:"hash,omitempty"`
+	// Role of the user, DefaultRole if not set
+	Role Level `json:"role,omitempty"`
+}
+
+// TokenLength is the number of random bytes in a token made by GenerateToken
+const TokenLength = 24
+
+// GenerateToken returns a new random token, URL-safe
+func GenerateToken() (string, error) {
+	b := make([]byte, TokenLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// NewCredential creates a credential with the token hashed by bcrypt (salted), so that the
+// token itself is not stored anywhere
+func NewCredential(token string, role Level) (*Credential, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(token), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	return &Credential{
+		Hash: string(hash),
+		Role: role,
+	}, nil
+}
+
+// parseCredential decodes a JSON credential record, or a plain text token (legacy format)
+func parseCredential(data []byte) (*Credential, error) {
+	c := &Credential{}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		if err := json.Unmarshal(data, c); err != nil {
+			return nil, err
+		}
+	} else {
+		c.Token = strings.TrimSpace(string(data))
+	}
+	if c.Role == 0 {
+		c.Role = DefaultRole
+	}
+	return c, nil
+}
+
+// Verify returns nil if the token matches the credential. Both plain text and hashed
+// tokens are compared in constant time.
+func (c *Credential) Verify(token string) error {
+	switch {
+	case c.Hash != "":
+		if !strings.HasPrefix(c.Hash, "$2") {
+			return ErrCannotVerify
+		}
+		if bcrypt.CompareHashAndPassword([]byte(c.Hash), []byte(token)) != nil {
+			return ErrIncorrectToken
+		}
+		return nil
+	case c.Token != "":
+		if subtle.ConstantTimeCompare([]byte(c.Token), []byte(token)) != 1 {
+			return ErrIncorrectToken
+		}
+		return nil
+	}
+	return ErrCannotVerify
+}
+
+// Backend provides credentials of the users
+type Backend interface {
+	// Credential returns the credential of the user, or ErrUnknownUser
+	Credential(user string) (*Credential, error)
+}
+
+// Writer is implemented by backends which can store credentials
+type Writer interface {
+	// SetCredential creates or replaces the credential of the user
+	SetCredential(user string, c *Credential) error
+}
+
+// validUserName returns false for names which can't be used as a file or object name
+func validUserName(user string) bool {
+	return user != "" && !strings.HasPrefix(user, ".") && !strings.ContainsAny(user, "/\\:\n")
+}
@@ -0,0 +1,72 @@
+package auth
+
+import "testing"
+
+func TestParseCredential(t *testing.T) {
+	for _, test := range []struct {
+		data string
+		want Credential
+		err  error
+	}{
+		{"secret", Credential{Token: "secret", Role: DefaultRole}, nil},
+		{" secret\n", Credential{Token: "secret", Role: DefaultRole}, nil},
+		{`{"token": "secret"}`, Credential{Token: "secret", Role: DefaultRole}, nil},
+		{`{"token": "secret", "role": "admin"}`, Credential{Token: "secret", Role: Admin}, nil},
+		{"\n" + `{"hash": "$2a$", "role": "viewer"}`, Credential{Hash: "$2a$", Role: Viewer}, nil},
+		{`{"token": "secret", "role": "superuser"}`, Credential{}, ErrUnknownRole},
+	} {
+		c, err := parseCredential([]byte(test.data))
+		if err != test.err {
+			t.Errorf("parseCredential(%q) error = %v, want %v", test.data, err, test.err)
+			continue
+		}
+		if err == nil && *c != test.want {
+			t.Errorf("parseCredential(%q) = %+v, want %+v", test.data, *c, test.want)
+		}
+	}
+}
+
+func TestLevel(t *testing.T) {
+	if !(Viewer < Operator && Operator < Admin) {
+		t.Error("Every next level must include the previous ones")
+	}
+	for _, level := range []Level{Viewer, Operator, Admin} {
+		parsed, err := ParseLevel(level.String())
+		if err != nil || parsed != level {
+			t.Errorf("ParseLevel(%q) = %v, %v", level.String(), parsed, err)
+		}
+	}
+	if _, err := Level(0).MarshalText(); err != ErrUnknownRole {
+		t.Errorf("MarshalText of zero level = %v, want ErrUnknownRole", err)
+	}
+}
+
+func TestNewCredential(t *testing.T) {
+	token, err := GenerateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := GenerateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token == other {
+		t.Fatalf("GenerateToken returned %q twice", token)
+	}
+	c, err := NewCredential(token, Operator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Token != "" || c.Hash == token || c.Role != Operator {
+		t.Errorf("NewCredential must store only the hash, got %+v", c)
+	}
+	if err = c.Verify(token); err != nil {
+		t.Errorf("Verify(token) = %v", err)
+	}
+	if err = c.Verify(other); err != ErrIncorrectToken {
+		t.Errorf("Verify(other token) = %v, want ErrIncorrectToken", err)
+	}
+	if again, _ := NewCredential(token, Operator); again != nil && again.Hash == c.Hash {
+		t.Error("Hashes of the same token must be salted")
+	}
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2/google"
+
+	"google.golang.org/api/googleapi"
+	storage "google.golang.org/api/storage/v1"
+)
+
+// GCSBackend reads credentials from GCS bucket, where objects are named after the users
+// and contain their JSON credential records (or just tokens)
+type GCSBackend struct {
+	gcs    *storage.Service
+	bucket string
+}
+
+// NewGCSBackend connects to GCS using the default credentials, with read only access
+func NewGCSBackend(ctx context.Context, bucket string) (*GCSBackend, error) {
+	return newGCSBackend(ctx, bucket, storage.DevstorageReadOnlyScope)
+}
+
+// NewWritableGCSBackend connects to GCS using the default credentials, with read-write
+// access to allow SetCredential
+func NewWritableGCSBackend(ctx context.Context, bucket string) (*GCSBackend, error) {
+	return newGCSBackend(ctx, bucket, storage.DevstorageReadWriteScope)
+}
+
+func newGCSBackend(ctx context.Context, bucket, scope string) (*GCSBackend, error) {
+	client, err := google.DefaultClient(ctx, scope)
+	if err != nil {
+		return nil, err
+	}
+	gcs, err := storage.New(client)
+	return &GCSBackend{
+		gcs:    gcs,
+		bucket: bucket,
+	}, err
+}
+
+// Credential downloads the object named after the user
+func (b *GCSBackend) Credential(user string) (*Credential, error) {
+	if !validUserName(user) {
+		return nil, ErrUnknownUser
+	}
+	r, err := b.gcs.Objects.Get(b.bucket, user).Download()
+	if err != nil {
+		if apiErr, ok := err.(*googleapi.Error); ok && apiErr.Code == http.StatusNotFound {
+			return nil, ErrUnknownUser
+		}
+		return nil, err
+	}
+	defer func() { _ = r.Body.Close() }()
+	var data bytes.Buffer
+	if _, err = data.ReadFrom(r.Body); err != nil {
+		return nil, err
+	}
+	return parseCredential(data.Bytes())
+}
+
+// SetCredential uploads the JSON credential record into the object named after the user
+func (b *GCSBackend) SetCredential(user string, c *Credential) error {
+	if !validUserName(user) {
+		return ErrInvalidUser
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	_, err = b.gcs.Objects.Insert(b.bucket, &storage.Object{
+		Name:        user,
+		ContentType: "application/json",
+	}).Media(bytes.NewReader(data)).Do()
+	return err
+}
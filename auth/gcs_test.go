@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	storage "google.golang.org/api/storage/v1"
+)
+
+func TestGCSBackend(t *testing.T) {
+	objects := map[string]string{
+		"/storage/v1/b/users/o/alice": "secret\n",
+		"/storage/v1/b/users/o/bob":   `{"token": "bobs", "role": "viewer"}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, found := objects[r.URL.Path]
+		if !found || r.URL.Query().Get("alt") != "media" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(data))
+	}))
+	defer server.Close()
+	gcs, err := storage.New(server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcs.BasePath = server.URL + "/storage/v1/"
+	b := &GCSBackend{gcs: gcs, bucket: "users"}
+
+	c, err := b.Credential("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Token != "secret" || c.Role != DefaultRole {
+		t.Errorf("Plain token object read as %+v", c)
+	}
+	if c, err = b.Credential("bob"); err != nil {
+		t.Fatal(err)
+	}
+	if c.Token != "bobs" || c.Role != Viewer {
+		t.Errorf("JSON record object read as %+v", c)
+	}
+	for _, user := range []string{"carol", "../alice", ".hidden"} {
+		if _, err = b.Credential(user); err != ErrUnknownUser {
+			t.Errorf("Credential(%q) = %v, want ErrUnknownUser", user, err)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Level of access granted to a user role
+type Level int
+
+// Access levels, every next level includes the previous ones
+const (
+	// Viewer can watch the camera and read sensors
+	Viewer Level = iota + 1
+	// Operator can also drive the rover and move the arm
+	Operator
+	// Admin can also change persistent settings
+	Admin
+)
+
+// ErrUnknownRole is returned when the role name in a credential record is not known
+var ErrUnknownRole = errors.New("Unknown role")
+
+var levelNames = map[Level]string{
+	Viewer:   "viewer",
+	Operator: "operator",
+	Admin:    "admin",
+}
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("Level(%d)", int(l))
+}
+
+// ParseLevel returns the Level for the role name
+func ParseLevel(name string) (Level, error) {
+	for level, levelName := range levelNames {
+		if levelName == name {
+			return level, nil
+		}
+	}
+	return 0, ErrUnknownRole
+}
+
+// MarshalText encodes the level as role name, e.g. in JSON
+func (l Level) MarshalText() ([]byte, error) {
+	if _, ok := levelNames[l]; !ok {
+		return nil, ErrUnknownRole
+	}
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText decodes the level from role name, e.g. in JSON
+func (l *Level) UnmarshalText(text []byte) (err error) {
+	*l, err = ParseLevel(string(text))
+	return
+}
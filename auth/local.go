@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dasfoo/rover/internal/atomicfile"
+)
+
+// DirBackend reads credentials from a local directory, where files are named after the users
+// and contain their JSON credential records or tokens (same layout as GCSBackend)
+type DirBackend struct {
+	dir string
+}
+
+// NewDirBackend creates a DirBackend for the directory
+func NewDirBackend(dir string) *DirBackend {
+	return &DirBackend{dir: dir}
+}
+
+// Credential reads the file named after the user
+func (b *DirBackend) Credential(user string) (*Credential, error) {
+	if !validUserName(user) {
+		return nil, ErrUnknownUser
+	}
+	data, err := ioutil.ReadFile(filepath.Join(b.dir, user))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrUnknownUser
+		}
+		return nil, err
+	}
+	return parseCredential(data)
+}
+
+// SetCredential writes the JSON credential record into the file named after the user
+func (b *DirBackend) SetCredential(user string, c *Credential) error {
+	if !validUserName(user) {
+		return ErrInvalidUser
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(filepath.Join(b.dir, user), append(data, '\n'))
+}
+
+// HtpasswdBackend reads credentials from an htpasswd file with bcrypt hashed tokens,
+// e.g. created by "htpasswd -B". A role may be appended to the line: "user:hash:role".
+type HtpasswdBackend struct {
+	filename string
+}
+
+// NewHtpasswdBackend creates an HtpasswdBackend for the file
+func NewHtpasswdBackend(filename string) *HtpasswdBackend {
+	return &HtpasswdBackend{filename: filename}
+}
+
+// Credential looks up the user in the file, which is read every time so that changes
+// are picked up without a restart
+func (b *HtpasswdBackend) Credential(user string) (*Credential, error) {
+	if !validUserName(user) {
+		return nil, ErrUnknownUser
+	}
+	f, err := os.Open(b.filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrUnknownUser
+		}
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) < 2 || fields[0] != user {
+			continue
+		}
+		c := &Credential{
+			Hash: fields[1],
+			Role: DefaultRole,
+		}
+		if len(fields) > 2 {
+			if c.Role, err = ParseLevel(fields[2]); err != nil {
+				return nil, err
+			}
+		}
+		return c, nil
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, ErrUnknownUser
+}
+
+// SetCredential replaces the line of the user in the file, or appends a new one.
+// Only hashed tokens can be stored.
+func (b *HtpasswdBackend) SetCredential(user string, c *Credential) error {
+	if !validUserName(user) {
+		return ErrInvalidUser
+	}
+	if c.Hash == "" {
+		return ErrCannotVerify
+	}
+	record := user + ":" + c.Hash
+	if c.Role != DefaultRole {
+		record += ":" + c.Role.String()
+	}
+	data, err := ioutil.ReadFile(b.filename)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var (
+		out      bytes.Buffer
+		replaced bool
+	)
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), user+":") {
+			if !replaced {
+				out.WriteString(record + "\n")
+				replaced = true
+			}
+			continue
+		}
+		out.WriteString(line)
+	}
+	if !replaced {
+		if out.Len() > 0 && !bytes.HasSuffix(out.Bytes(), []byte("\n")) {
+			out.WriteByte('\n')
+		}
+		out.WriteString(record + "\n")
+	}
+	return atomicfile.WriteFile(b.filename, out.Bytes())
+}
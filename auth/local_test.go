@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func writeFile(t *testing.T, filename, data string) {
+	if err := ioutil.WriteFile(filename, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func hashToken(t *testing.T, token string) string {
+	hash, err := bcrypt.GenerateFromPassword([]byte(token), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(hash)
+}
+
+func TestDirBackend(t *testing.T) {
+	dir := tempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+	writeFile(t, filepath.Join(dir, "alice"), "secret\n")
+	writeFile(t, filepath.Join(dir, ".hidden"), "hidden")
+	writeFile(t, filepath.Join(filepath.Dir(dir), "x"), "outside")
+	defer func() { _ = os.Remove(filepath.Join(filepath.Dir(dir), "x")) }()
+	b := NewDirBackend(dir)
+
+	c, err := b.Credential("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Token != "secret" {
+		t.Errorf("Plain token with trailing newline read as %+v", c)
+	}
+	if err = c.Verify("secret"); err != nil {
+		t.Errorf("Plain token doesn't verify: %s", err)
+	}
+	if err = c.Verify("secret\n"); err != ErrIncorrectToken {
+		t.Errorf("Verify(wrong token) = %v, want ErrIncorrectToken", err)
+	}
+
+	for _, user := range []string{"carol", "../x", ".hidden", "", "a/b"} {
+		if _, err = b.Credential(user); err != ErrUnknownUser {
+			t.Errorf("Credential(%q) = %v, want ErrUnknownUser", user, err)
+		}
+	}
+}
+
+func TestHtpasswdBackend(t *testing.T) {
+	dir := tempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+	filename := filepath.Join(dir, "htpasswd")
+	writeFile(t, filename, "# bob:"+hashToken(t, "commented")+"\n\n"+
+		"alice:"+hashToken(t, "secret")+"\n"+
+		"mallory:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n")
+	b := NewHtpasswdBackend(filename)
+
+	c, err := b.Credential("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Verify("secret"); err != nil {
+		t.Errorf("Hashed token doesn't verify: %s", err)
+	}
+	if err = c.Verify("wrong"); err != ErrIncorrectToken {
+		t.Errorf("Verify(wrong token) = %v, want ErrIncorrectToken", err)
+	}
+	if c, err = b.Credential("mallory"); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Verify("password"); err != ErrCannotVerify {
+		t.Errorf("Verify with SHA1 hash = %v, want ErrCannotVerify", err)
+	}
+
+	for _, user := range []string{"bob", "# bob", "carol", "../htpasswd", ""} {
+		if _, err = b.Credential(user); err != ErrUnknownUser {
+			t.Errorf("Credential(%q) = %v, want ErrUnknownUser", user, err)
+		}
+	}
+
+	if _, err = NewHtpasswdBackend(filepath.Join(dir, "missing")).Credential("alice"); err !=
+		ErrUnknownUser {
+		t.Errorf("Credential from missing file = %v, want ErrUnknownUser", err)
+	}
+}
+
+func TestHtpasswdBackendRoles(t *testing.T) {
+	dir := tempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+	filename := filepath.Join(dir, "htpasswd")
+	hash := hashToken(t, "secret")
+	writeFile(t, filename, "alice:"+hash+"\n"+
+		"bob:"+hash+":viewer\n"+
+		"eve:"+hash+":superuser\n")
+	b := NewHtpasswdBackend(filename)
+
+	for user, role := range map[string]Level{"alice": DefaultRole, "bob": Viewer} {
+		c, err := b.Credential(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Role != role {
+			t.Errorf("Role of %s read as %s, want %s", user, c.Role, role)
+		}
+	}
+	if _, err := b.Credential("eve"); err != ErrUnknownRole {
+		t.Errorf("Credential with unknown role = %v, want ErrUnknownRole", err)
+	}
+}
+
+func TestDirBackendSetCredential(t *testing.T) {
+	dir := tempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+	b := NewDirBackend(dir)
+	c, err := NewCredential("token", Viewer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = b.SetCredential("dave", c); err != nil {
+		t.Fatal(err)
+	}
+	if c, err = b.Credential("dave"); err != nil {
+		t.Fatal(err)
+	}
+	if c.Token != "" || c.Role != Viewer || c.Verify("token") != nil {
+		t.Errorf("Stored credential read as %+v", c)
+	}
+	if err = b.SetCredential("../x", c); err != ErrInvalidUser {
+		t.Errorf("SetCredential(\"../x\") = %v, want ErrInvalidUser", err)
+	}
+}
+
+func TestHtpasswdBackendSetCredential(t *testing.T) {
+	dir := tempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+	filename := filepath.Join(dir, "htpasswd")
+	writeFile(t, filename, "# users\nalice:old")
+	b := NewHtpasswdBackend(filename)
+	first, err := NewCredential("first", Admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewCredential("second", DefaultRole)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, set := range []struct {
+		user string
+		c    *Credential
+	}{
+		{"bob", first},
+		{"alice", second},
+	} {
+		if err = b.SetCredential(set.user, set.c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# users\nalice:" + second.Hash + "\nbob:" + first.Hash + ":admin\n"
+	if string(data) != want {
+		t.Errorf("File contents:\n%s\nwant:\n%s", data, want)
+	}
+	if err = b.SetCredential("carol", &Credential{Token: "plain"}); err != ErrCannotVerify {
+		t.Errorf("SetCredential with plain token = %v, want ErrCannotVerify", err)
+	}
+}
@@ -1,90 +1,125 @@
 package auth
 
 import (
-	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
 	"errors"
 	"log"
 	"time"
 
-	"golang.org/x/net/context"
-	"golang.org/x/oauth2/google"
-
 	cache "github.com/patrickmn/go-cache"
+)
 
-	storage "google.golang.org/api/storage/v1"
+// Error definitions
+var (
+	ErrUnknownUser    = errors.New("Unknown user")
+	ErrIncorrectToken = errors.New("Incorrect token supplied")
+	ErrCannotVerify   = errors.New("Cannot verify the token")
+	ErrAccessDenied   = errors.New("The user role doesn't allow this action")
+	ErrInvalidUser    = errors.New("Invalid user name")
+	ErrUserExists     = errors.New("User already exists")
+	ErrReadOnly       = errors.New("Credentials backend is read only")
 )
 
-// Manager provides cached authentication from GCS via user name and token
+// Manager provides cached authentication from a Backend via user name and token
 type Manager struct {
 	authCache *cache.Cache
-	gcs       *storage.Service
-	gcsBucket string
+	// verified has digests of tokens which matched a hashed credential, to skip bcrypt
+	verified *cache.Cache
+	backend  Backend
+	// sessionKey signs session tokens, nil if sessions are not available
+	sessionKey []byte
+	lockout    *lockout
+	auditf     func(string, ...interface{})
 }
 
-// NewManager connects to GCS
-func NewManager(ctx context.Context, gcsBucket string) (*Manager, error) {
-	if gcsBucket == "" {
-		log.Println("Authentication is disabled, no GCS bucket with authentication data provided")
-		return &Manager{}, nil
-	}
-	am := Manager{
-		// 5 minute TTL, purge every 30 seconds.
-		authCache: cache.New(5*time.Minute, 30*time.Second),
-		gcsBucket: gcsBucket,
+// NewManager creates a Manager for the backend; nil backend disables authentication
+func NewManager(backend Backend) *Manager {
+	if backend == nil {
+		log.Println("Authentication is disabled, no credentials backend provided")
+		return &Manager{
+			lockout: newLockout(),
+			auditf:  log.Printf,
+		}
 	}
-	client, err := google.DefaultClient(ctx, storage.DevstorageReadOnlyScope)
+	key, err := newSessionKey()
 	if err != nil {
-		return nil, err
+		log.Println("Session tokens are disabled:", err)
+		key = nil
 	}
-	am.gcs, err = storage.New(client)
-	return &am, err
-}
-
-func (am *Manager) fetchAuthToken(user string) (string, error) {
-	r, err := am.gcs.Objects.Get(am.gcsBucket, user).Download()
-	if err != nil {
-		return "", err
+	return &Manager{
+		// 5 minute TTL, purge every 30 seconds.
+		authCache:  cache.New(5*time.Minute, 30*time.Second),
+		verified:   cache.New(5*time.Minute, 30*time.Second),
+		backend:    backend,
+		sessionKey: key,
+		lockout:    newLockout(),
+		auditf:     log.Printf,
 	}
-	var b bytes.Buffer
-	_, err = b.ReadFrom(r.Body)
-	// TODO(dotdoom): encode files in JSON
-	return string(b.Bytes()), err
 }
 
-func (am *Manager) getAuthToken(user string) (string, error) {
-	token, found := am.authCache.Get(user)
+func (am *Manager) getCredential(user string) (*Credential, error) {
+	credential, found := am.authCache.Get(user)
 	if found {
-		return token.(string), nil
+		return credential.(*Credential), nil
 	}
-	tokenString, err := am.fetchAuthToken(user)
+	c, err := am.backend.Credential(user)
 	if err == nil {
-		am.authCache.Set(user, tokenString, cache.DefaultExpiration)
+		am.authCache.Set(user, c, cache.DefaultExpiration)
 	}
-	return tokenString, err
+	return c, err
 }
 
-// CheckAccess returns nil if access is granted
-func (am *Manager) CheckAccess(user, token string) error {
-	// TODO(dotdoom): add 3rd parameter, level
-	// TODO(dotdoom): log auth errors
-	var (
-		actualToken string
-		err         error
-	)
-	if am.gcs == nil {
-		actualToken = ""
+// verify checks the token against the credential, remembering tokens matching a hash,
+// because bcrypt is deliberately slow
+func (am *Manager) verify(user string, credential *Credential, token string) error {
+	if credential.Hash == "" {
+		return credential.Verify(token)
+	}
+	// The hash changes when the token is rotated, so old tokens are not remembered
+	key := user + ":" + credential.Hash
+	digest := sha256.Sum256([]byte(token))
+	if known, found := am.verified.Get(key); found {
+		knownDigest := known.([sha256.Size]byte)
+		if subtle.ConstantTimeCompare(knownDigest[:], digest[:]) == 1 {
+			return nil
+		}
+	}
+	if err := credential.Verify(token); err != nil {
+		return err
+	}
+	am.verified.Set(key, digest, cache.DefaultExpiration)
+	return nil
+}
+
+// CheckAccess returns nil if the token is valid and the user role allows the level of access.
+// The token is either the user token, or a session token issued by Login.
+func (am *Manager) CheckAccess(user, token string, level Level) error {
+	if am.backend == nil {
+		if token != "" {
+			return ErrIncorrectToken
+		}
+		return nil
+	}
+	var role Level
+	if isSession(token) {
+		claims, err := am.verifySession(user, token)
+		if err != nil {
+			return err
+		}
+		role = claims.Role
 	} else {
-		actualToken, err = am.getAuthToken(user)
+		credential, err := am.getCredential(user)
 		if err != nil {
 			return err
 		}
-		if actualToken == "" {
-			return errors.New("Cannot verify the token")
+		if err = am.verify(user, credential, token); err != nil {
+			return err
 		}
+		role = credential.Role
 	}
-
-	if actualToken != token {
-		return errors.New("Incorrect token supplied")
+	if role < level {
+		return ErrAccessDenied
 	}
 	return nil
 }
@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Session token lifetime
+const (
+	// SessionTTL is how long a session token is valid after it's issued or refreshed
+	SessionTTL = 15 * time.Minute
+	// MaxSessionAge is how long a session can be refreshed after login with the user token
+	MaxSessionAge = 12 * time.Hour
+	// SessionPrefix starts every session token, to tell it from the user token
+	SessionPrefix = "rs1."
+	// sessionKeyLength is the size of HMAC key in bytes
+	sessionKeyLength = 32
+)
+
+// ErrSessionExpired is returned for a session token past its expiry time
+var ErrSessionExpired = errors.New("Session has expired")
+
+// Session is a short-lived signed token issued by Login
+type Session struct {
+	// Token to use instead of the user token; the user name must still be supplied
+	Token string
+	// Role of the user at login time
+	Role Level
+	// Expires is when the Token stops being accepted
+	Expires time.Time
+}
+
+// sessionClaims are signed and carried inside the session token
+type sessionClaims struct {
+	User string `json:"u"`
+	Role Level  `json:"r"`
+	// Login is when the user token was verified, unix seconds
+	Login int64 `json:"l"`
+	// Expires is the token expiry, unix seconds
+	Expires int64 `json:"e"`
+}
+
+// newSessionKey returns a random HMAC key. Sessions don't survive a restart of the server,
+// and clients have to login again.
+func newSessionKey() ([]byte, error) {
+	key := make([]byte, sessionKeyLength)
+	_, err := rand.Read(key)
+	return key, err
+}
+
+func (am *Manager) sign(payload string) string {
+	mac := hmac.New(sha256.New, am.sessionKey)
+	_, _ = mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// issueSession creates a session token signed by the Manager key
+func (am *Manager) issueSession(claims sessionClaims) (*Session, error) {
+	if am.sessionKey == nil {
+		return nil, ErrCannotVerify
+	}
+	expires := time.Now().Add(SessionTTL)
+	claims.Expires = expires.Unix()
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+	payload := SessionPrefix + base64.RawURLEncoding.EncodeToString(data)
+	return &Session{
+		Token:   payload + "." + am.sign(payload),
+		Role:    claims.Role,
+		Expires: time.Unix(claims.Expires, 0),
+	}, nil
+}
+
+// verifySession checks the session token signature and expiry, and returns its claims
+func (am *Manager) verifySession(user, token string) (*sessionClaims, error) {
+	if am.sessionKey == nil {
+		return nil, ErrCannotVerify
+	}
+	dot := strings.LastIndex(token, ".")
+	if dot < len(SessionPrefix) {
+		return nil, ErrIncorrectToken
+	}
+	payload := token[:dot]
+	if !hmac.Equal([]byte(token[dot+1:]), []byte(am.sign(payload))) {
+		return nil, ErrIncorrectToken
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload[len(SessionPrefix):])
+	if err != nil {
+		return nil, ErrIncorrectToken
+	}
+	claims := &sessionClaims{}
+	if err = json.Unmarshal(data, claims); err != nil {
+		return nil, ErrIncorrectToken
+	}
+	if claims.User != user {
+		return nil, ErrIncorrectToken
+	}
+	if time.Now().Unix() >= claims.Expires {
+		return nil, ErrSessionExpired
+	}
+	return claims, nil
+}
+
+// isSession tells whether the token is a session token rather than the user token
+func isSession(token string) bool {
+	return strings.HasPrefix(token, SessionPrefix)
+}
+
+// Login exchanges the user token for a session token, verified by the Manager without
+// a round-trip to the backend. A session token is refreshed: a new one is issued with the
+// current role of the user, unless the user is gone from the backend or it's been more than
+// MaxSessionAge since login with the user token.
+func (am *Manager) Login(user, token string) (*Session, error) {
+	if am.backend == nil {
+		if token != "" {
+			return nil, ErrIncorrectToken
+		}
+		// Authentication is disabled, and empty token is all it takes
+		return &Session{
+			Role:    Admin,
+			Expires: time.Now().Add(SessionTTL),
+		}, nil
+	}
+	if isSession(token) {
+		claims, err := am.verifySession(user, token)
+		if err != nil {
+			return nil, err
+		}
+		if time.Since(time.Unix(claims.Login, 0)) > MaxSessionAge {
+			return nil, ErrSessionExpired
+		}
+		credential, err := am.getCredential(user)
+		if err != nil {
+			return nil, err
+		}
+		claims.Role = credential.Role
+		return am.issueSession(*claims)
+	}
+	credential, err := am.getCredential(user)
+	if err != nil {
+		return nil, err
+	}
+	if err = am.verify(user, credential, token); err != nil {
+		return nil, err
+	}
+	return am.issueSession(sessionClaims{
+		User:  user,
+		Role:  credential.Role,
+		Login: time.Now().Unix(),
+	})
+}
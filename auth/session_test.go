@@ -0,0 +1,43 @@
+package auth
+
+import "testing"
+
+// mapBackend keeps credentials in memory
+type mapBackend map[string]*Credential
+
+func (b mapBackend) Credential(user string) (*Credential, error) {
+	if c, found := b[user]; found {
+		return c, nil
+	}
+	return nil, ErrUnknownUser
+}
+
+func TestLoginRefresh(t *testing.T) {
+	backend := mapBackend{"alice": {Token: "secret", Role: Admin}}
+	am := NewManager(backend)
+	session, err := am.Login("alice", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Role != Admin {
+		t.Errorf("Session role is %s, want admin", session.Role)
+	}
+
+	backend["alice"] = &Credential{Token: "secret", Role: Viewer}
+	am.authCache.Flush()
+	if session, err = am.Login("alice", session.Token); err != nil {
+		t.Fatal(err)
+	}
+	if session.Role != Viewer {
+		t.Errorf("Refreshed session role is %s, want the current role viewer", session.Role)
+	}
+	if err = am.CheckAccess("alice", session.Token, Operator); err != ErrAccessDenied {
+		t.Errorf("CheckAccess with the refreshed session = %v, want ErrAccessDenied", err)
+	}
+
+	delete(backend, "alice")
+	am.authCache.Flush()
+	if _, err = am.Login("alice", session.Token); err != ErrUnknownUser {
+		t.Errorf("Refresh of a removed user = %v, want ErrUnknownUser", err)
+	}
+}
@@ -0,0 +1,48 @@
+package auth
+
+// AddUser creates a user with a new random token, which is returned. Only the token hash
+// is written to the backend.
+func AddUser(backend Backend, user string, role Level) (string, error) {
+	if _, err := backend.Credential(user); err != ErrUnknownUser {
+		if err == nil {
+			err = ErrUserExists
+		}
+		return "", err
+	}
+	return writeToken(backend, user, role)
+}
+
+// RotateUser replaces the token of an existing user with a new random one, which is returned.
+// The role is kept unless a new one is given (non-zero).
+func RotateUser(backend Backend, user string, role Level) (string, error) {
+	c, err := backend.Credential(user)
+	if err != nil {
+		return "", err
+	}
+	if role == 0 {
+		role = c.Role
+	}
+	return writeToken(backend, user, role)
+}
+
+func writeToken(backend Backend, user string, role Level) (string, error) {
+	w, ok := backend.(Writer)
+	if !ok {
+		return "", ErrReadOnly
+	}
+	if !validUserName(user) {
+		return "", ErrInvalidUser
+	}
+	if _, ok := levelNames[role]; !ok {
+		return "", ErrUnknownRole
+	}
+	token, err := GenerateToken()
+	if err != nil {
+		return "", err
+	}
+	c, err := NewCredential(token, role)
+	if err != nil {
+		return "", err
+	}
+	return token, w.SetCredential(user, c)
+}
@@ -0,0 +1,174 @@
+package battery
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Error definitions
+var (
+	ErrUnknownChemistry = errors.New("Unknown battery chemistry and no discharge curve")
+	ErrInvalidConfig    = errors.New("Battery reference voltage, resolution, divider ratio " +
+		"and cells must be positive")
+)
+
+// Point of the discharge curve: cell Voltage at which the battery has Percentage left
+type Point struct {
+	Voltage    float64
+	Percentage float64
+}
+
+// Curves of a single cell discharge for common chemistries, sorted by voltage
+var Curves = map[string][]Point{
+	"lipo": {
+		{3.27, 0}, {3.61, 5}, {3.69, 10}, {3.71, 15}, {3.73, 20}, {3.75, 25}, {3.77, 30},
+		{3.79, 35}, {3.80, 40}, {3.82, 45}, {3.84, 50}, {3.85, 55}, {3.87, 60}, {3.91, 65},
+		{3.95, 70}, {3.98, 75}, {4.02, 80}, {4.08, 85}, {4.11, 90}, {4.15, 95}, {4.20, 100},
+	},
+	"nimh": {
+		{1.00, 0}, {1.10, 5}, {1.18, 15}, {1.22, 30}, {1.25, 50}, {1.28, 70}, {1.32, 90},
+		{1.42, 100},
+	},
+}
+
+// Config describes how the battery voltage is measured by the board
+type Config struct {
+	// ReferenceVoltage of the board ADC, in volts
+	ReferenceVoltage float64
+	// Resolution of the board ADC, i.e. max value + 1
+	Resolution float64
+	// DividerRatio is the battery voltage divided by the voltage at the analog pin
+	DividerRatio float64
+	// Cells connected in series
+	Cells int
+	// Chemistry selects the discharge curve from Curves, unless Curve is set
+	Chemistry string
+	// Curve of a single cell discharge, sorted by voltage
+	Curve []Point
+	// Smoothing is the time constant of the voltage filter in seconds, to suppress voltage
+	// sag under motor load; 0 disables the filter
+	Smoothing float64
+}
+
+// DefaultConfig matches 2S LiPo battery connected to 5V Arduino through 20k/10k divider
+var DefaultConfig = Config{
+	ReferenceVoltage: 5,
+	Resolution:       1024,
+	DividerRatio:     3,
+	Cells:            2,
+	Chemistry:        "lipo",
+	Smoothing:        10,
+}
+
+// LoadConfig reads Config from a JSON file; missing fields are taken from DefaultConfig
+func LoadConfig(filename string) (*Config, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	c := DefaultConfig
+	return &c, json.Unmarshal(b, &c)
+}
+
+// Validate returns an error if the config can't be used to compute the percentage
+func (c *Config) Validate() error {
+	if !(c.ReferenceVoltage > 0 && c.Resolution > 0 && c.DividerRatio > 0 && c.Cells > 0 &&
+		c.Smoothing >= 0) {
+		return ErrInvalidConfig
+	}
+	if len(c.Curve) == 0 && len(Curves[c.Chemistry]) == 0 {
+		return ErrUnknownChemistry
+	}
+	return nil
+}
+
+// Voltage of the battery for the raw ADC value
+func (c *Config) Voltage(raw uint16) float64 {
+	return float64(raw) * c.ReferenceVoltage / c.Resolution * c.DividerRatio
+}
+
+// Percentage of the battery charge left at voltage, interpolated on the discharge curve
+func (c *Config) Percentage(voltage float64) (float64, error) {
+	curve := c.Curve
+	if len(curve) == 0 {
+		if curve = Curves[c.Chemistry]; len(curve) == 0 {
+			return 0, ErrUnknownChemistry
+		}
+	}
+	cell := voltage / float64(c.Cells)
+	i := sort.Search(len(curve), func(i int) bool {
+		return curve[i].Voltage >= cell
+	})
+	switch i {
+	case 0:
+		return curve[0].Percentage, nil
+	case len(curve):
+		return curve[len(curve)-1].Percentage, nil
+	}
+	lo, hi := curve[i-1], curve[i]
+	return lo.Percentage + (hi.Percentage-lo.Percentage)*
+		(cell-lo.Voltage)/(hi.Voltage-lo.Voltage), nil
+}
+
+// Reader reads the raw battery ADC value, e.g. bb.BB
+type Reader interface {
+	GetBatteryRaw() (uint16, error)
+}
+
+// Reading of the battery state
+type Reading struct {
+	// Voltage, filtered over the recent readings
+	Voltage float64
+	// Percentage of charge left
+	Percentage float64
+}
+
+// Monitor reads and filters battery voltage
+type Monitor struct {
+	reader Reader
+	config Config
+
+	mu sync.Mutex
+	// voltage is the filtered voltage at sampled time
+	voltage float64
+	sampled time.Time
+}
+
+// NewMonitor creates a Monitor which gets raw values from reader
+func NewMonitor(reader Reader, config Config) (*Monitor, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &Monitor{
+		reader: reader,
+		config: config,
+	}, nil
+}
+
+// Read measures the battery and returns the filtered voltage. Every reading is weighted
+// by the time since the previous one, so the filter doesn't depend on how often it's read.
+func (m *Monitor) Read() (Reading, error) {
+	raw, err := m.reader.GetBatteryRaw()
+	if err != nil {
+		return Reading{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	voltage := m.config.Voltage(raw)
+	now := time.Now()
+	if m.sampled.IsZero() || m.config.Smoothing == 0 {
+		m.voltage = voltage
+	} else {
+		weight := 1 - math.Exp(-now.Sub(m.sampled).Seconds()/m.config.Smoothing)
+		m.voltage += (voltage - m.voltage) * weight
+	}
+	m.sampled = now
+	r := Reading{Voltage: m.voltage}
+	r.Percentage, err = m.config.Percentage(r.Voltage)
+	return r, err
+}
@@ -3,7 +3,9 @@ package bb
 // #include "bb.h"
 import "C"
 import (
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/dasfoo/i2c"
@@ -22,19 +24,47 @@ const (
 	MaxTilt = C.MaxTilt
 )
 
+// MaxAngle is the max servo angle (degrees) for the robotic arm
+const MaxAngle = 180
+
+// ErrAngleOutOfRange is returned when servo angle is outside of the allowed range
+var ErrAngleOutOfRange = errors.New("Servo angle is out of range")
+
+// Environment sensor measurement is polled with this interval until timeout
+const (
+	measurePollInterval = 50 * time.Millisecond
+	measureTimeout      = 2 * time.Second
+)
+
+// bootPollInterval is how often the status is polled while the board is booting
+const bootPollInterval = 100 * time.Millisecond
+
 // StatusError is returned when the status returned by BB is not compatible with the command
 type StatusError struct {
 	Status uint16
+	// Required bits, which are missing from Status
+	Required uint16
 }
 
 func (se *StatusError) Error() string {
-	return fmt.Sprintf("The module requested is not ready (status bits %.16b)", se.Status)
+	return fmt.Sprintf("The module requested is not ready (status bits %.16b, required %.16b)",
+		se.Status, se.Required)
 }
 
 // BB is a control interface for BotBoarduino part of the project
 type BB struct {
 	bus     i2c.Bus
 	address byte
+	// state is shared with the BB views created by session
+	*state
+}
+
+// state is the last state commanded, which is lost when the board resets.
+// The lock is not held during bus transactions, which may wait for a session.
+type state struct {
+	mu     sync.Mutex
+	awake  bool
+	servos map[byte]byte
 }
 
 // NewBB creates a new instance of BotBoarduino to use
@@ -42,6 +72,9 @@ func NewBB(bus i2c.Bus, addr byte) *BB {
 	return &BB{
 		bus:     bus,
 		address: addr,
+		state: &state{
+			servos: make(map[byte]byte),
+		},
 	}
 }
 
@@ -53,10 +86,107 @@ func (bb *BB) Reset(pin byte) {
 	resetPin.SetMode(gpio.INPUT)
 }
 
+// Restore waits for the board to boot (e.g. after Reset) and re-applies the servo angles
+// and wake state last commanded
+func (bb *BB) Restore(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		// The board doesn't respond at all while the bootloader runs
+		err := bb.checkReady(ModuleCommand, ModuleBoard)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(bootPollInterval)
+	}
+
+	bb.mu.Lock()
+	servos := make(map[byte]byte, len(bb.servos))
+	for reg, angle := range bb.servos {
+		servos[reg] = angle
+	}
+	awake := bb.awake
+	bb.mu.Unlock()
+	// Servos keep the angle while detached, so write them before Wake to avoid jerking
+	for reg, angle := range servos {
+		if err := bb.bus.WriteByteToReg(bb.address, reg, angle); err != nil {
+			return err
+		}
+	}
+	if awake {
+		return bb.bus.WriteByteToReg(bb.address, register(ModuleCommand), commandWake)
+	}
+	return nil
+}
+
+// Awake returns true if the board has been woken up (servos are attached)
+func (bb *BB) Awake() bool {
+	bb.mu.Lock()
+	defer bb.mu.Unlock()
+	return bb.awake
+}
+
+// writeServo sends angle to the servo register, and remembers it for Restore
+func (bb *BB) writeServo(reg, angle byte) error {
+	if err := bb.bus.WriteByteToReg(bb.address, reg, angle); err != nil {
+		return err
+	}
+	bb.mu.Lock()
+	defer bb.mu.Unlock()
+	bb.servos[reg] = angle
+	return nil
+}
+
+// command sends the command to the board, and remembers wake state for Restore
+func (bb *BB) command(command byte) error {
+	if err := bb.bus.WriteByteToReg(bb.address, register(ModuleCommand), command); err != nil {
+		return err
+	}
+	bb.mu.Lock()
+	defer bb.mu.Unlock()
+	switch command {
+	case commandSleep:
+		bb.awake = false
+	case commandWake:
+		bb.awake = true
+	}
+	return nil
+}
+
 func register(module int) byte {
 	return byte(module << 4)
 }
 
+// checkReady returns StatusError unless all of the modules are ready
+func (bb *BB) checkReady(modules ...int) error {
+	var required uint16
+	for _, module := range modules {
+		required |= 1 << uint(module)
+	}
+	status, err := bb.GetStatus()
+	if err != nil {
+		return err
+	}
+	if status&required != required {
+		return &StatusError{Status: status, Required: required}
+	}
+	return nil
+}
+
+// waitReady polls the status until all of the modules are ready, or timeout expires
+func (bb *BB) waitReady(timeout time.Duration, modules ...int) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := bb.checkReady(modules...)
+		if _, notReady := err.(*StatusError); !notReady || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(measurePollInterval)
+	}
+}
+
 ///////////////////////////////////////////////////////////////////////////////////////////////////
 
 // Sending commands/actions to Arduino
@@ -69,12 +199,18 @@ const (
 
 // Sleep reduces power usage of the module (and some hardware)
 func (bb *BB) Sleep() error {
-	return bb.bus.WriteByteToReg(bb.address, register(ModuleCommand), commandSleep)
+	if err := bb.checkReady(ModuleCommand); err != nil {
+		return err
+	}
+	return bb.command(commandSleep)
 }
 
 // Wake is necessary to re-enable hardware disabled by Sleep()
 func (bb *BB) Wake() error {
-	return bb.bus.WriteByteToReg(bb.address, register(ModuleCommand), commandWake)
+	if err := bb.checkReady(ModuleCommand); err != nil {
+		return err
+	}
+	return bb.command(commandWake)
 }
 
 ///////////////////////////////////////////////////////////////////////////////////////////////////
@@ -95,12 +231,22 @@ func (bb *BB) GetStatus() (uint16, error) {
 	return bb.bus.ReadWordFromReg(bb.address, register(ModuleBoard)+moduleBoardStatus)
 }
 
-// GetBatteryPercentage returns estimated battery charge, in percent
+// GetBatteryRaw returns battery voltage as measured by the ADC (0-1023), see battery.Config
+func (bb *BB) GetBatteryRaw() (uint16, error) {
+	if e := bb.checkReady(ModuleBoard); e != nil {
+		return 0, e
+	}
+	return bb.bus.ReadWordFromReg(bb.address, register(ModuleBoard)+moduleBoardBattery)
+}
+
+// GetBatteryPercentage returns uncalibrated battery charge, in percent, as a quarter of
+// the raw ADC value like it always did.
+//
+// Deprecated: use battery.Monitor with GetBatteryRaw, which can be calibrated and filters
+// the voltage.
 func (bb *BB) GetBatteryPercentage() (byte, error) {
-	// TODO: check status
-	v, e := bb.bus.ReadWordFromReg(bb.address, register(ModuleBoard)+moduleBoardBattery)
-	// TODO: calibration
-	return byte(v >> 2), e
+	raw, err := bb.GetBatteryRaw()
+	return byte(raw >> 2), err
 }
 
 ///////////////////////////////////////////////////////////////////////////////////////////////////
@@ -112,7 +258,9 @@ const (
 
 // GetAmbientLight returns ambient light brightness in range 0..1023
 func (bb *BB) GetAmbientLight() (uint16, error) {
-	// TODO: check status
+	if e := bb.checkReady(ModuleLightSensor); e != nil {
+		return 0, e
+	}
 	return bb.bus.ReadWordFromReg(bb.address, register(ModuleLightSensor))
 }
 
@@ -125,15 +273,45 @@ const (
 	moduleEnvironmentSensorHumidity    = C.ModuleEnvironmentSensorHumidity
 )
 
+// sessionBus is implemented by buses which can give exclusive access to a device,
+// e.g. arbiter.Arbiter
+type sessionBus interface {
+	Session(addr byte, fn func(bus i2c.Bus) error) error
+}
+
+// session runs fn with exclusive access to BB, if the bus supports it.
+// The state commanded within the session is shared with bb.
+func (bb *BB) session(fn func(bb *BB) error) error {
+	if s, ok := bb.bus.(sessionBus); ok {
+		return s.Session(bb.address, func(bus i2c.Bus) error {
+			return fn(&BB{bus: bus, address: bb.address, state: bb.state})
+		})
+	}
+	return fn(bb)
+}
+
 // GetTemperatureAndHumidity gets ambient temperature in Celsius and relative humidity in %
 func (bb *BB) GetTemperatureAndHumidity() (t byte, h byte, e error) {
-	// TODO: check status
+	// Measure-then-read must not interleave with another measurement
+	e = bb.session(func(bb *BB) (err error) {
+		t, h, err = bb.measureEnvironment()
+		return
+	})
+	return
+}
+
+func (bb *BB) measureEnvironment() (t byte, h byte, e error) {
+	// Let the measurement in progress (if any) finish first
+	if e = bb.waitReady(measureTimeout, ModuleCommand, ModuleEnvironmentSensor); e != nil {
+		return
+	}
 	if e = bb.bus.WriteByteToReg(bb.address,
 		register(ModuleCommand), commandMeasureEnvironment); e != nil {
 		return
 	}
-	// TODO: check status instead of Sleep()
-	time.Sleep(500 * time.Millisecond)
+	if e = bb.waitReady(measureTimeout, ModuleEnvironmentSensor); e != nil {
+		return
+	}
 	if t, e = bb.bus.ReadByteFromReg(bb.address,
 		register(ModuleEnvironmentSensor)+moduleEnvironmentSensorTemperature); e != nil {
 		return
@@ -152,8 +330,13 @@ const (
 
 // Tilt the LIDAR (or anything else attached to Tilt) for angle degrees (MinTilt-MaxTilt)
 func (bb *BB) Tilt(angle byte) error {
-	// TODO: check status
-	return bb.bus.WriteByteToReg(bb.address, register(ModuleTilt), angle)
+	if angle < MinTilt || angle > MaxTilt {
+		return ErrAngleOutOfRange
+	}
+	if err := bb.checkReady(ModuleTilt); err != nil {
+		return err
+	}
+	return bb.writeServo(register(ModuleTilt), angle)
 }
 
 ///////////////////////////////////////////////////////////////////////////////////////////////////
@@ -169,38 +352,114 @@ const (
 	moduleArmGrip        = C.ModuleArmGrip
 )
 
+func (bb *BB) writeArm(servo, angle byte) error {
+	if angle > MaxAngle {
+		return ErrAngleOutOfRange
+	}
+	if err := bb.checkReady(ModuleArm); err != nil {
+		return err
+	}
+	return bb.writeServo(register(ModuleArm)+servo, angle)
+}
+
 // ArmBasePan commands BB to rotate robotic arm base, 0-180 degrees
 func (bb *BB) ArmBasePan(angle byte) error {
-	// TODO: check status
-	return bb.bus.WriteByteToReg(bb.address, register(ModuleArm)+moduleArmBasePan, angle)
+	return bb.writeArm(moduleArmBasePan, angle)
 }
 
 // ArmBaseTilt commands BB to tilt robotic arm, 0-180 degrees
 func (bb *BB) ArmBaseTilt(angle byte) error {
-	// TODO: check status
-	return bb.bus.WriteByteToReg(bb.address, register(ModuleArm)+moduleArmBaseTilt, angle)
+	return bb.writeArm(moduleArmBaseTilt, angle)
 }
 
 // ArmElbow commands BB to bend robotic arm's elbow, 0-180 degrees
 func (bb *BB) ArmElbow(angle byte) error {
-	// TODO: check status
-	return bb.bus.WriteByteToReg(bb.address, register(ModuleArm)+moduleArmElbow, angle)
+	return bb.writeArm(moduleArmElbow, angle)
 }
 
 // ArmWristRotate commands BB to rotate the wrist, 0-180 degrees
 func (bb *BB) ArmWristRotate(angle byte) error {
-	// TODO: check status
-	return bb.bus.WriteByteToReg(bb.address, register(ModuleArm)+moduleArmWristRotate, angle)
+	return bb.writeArm(moduleArmWristRotate, angle)
 }
 
 // ArmWristTilt commands BB to tilt the wrist, 0-180 degrees
 func (bb *BB) ArmWristTilt(angle byte) error {
-	// TODO: check status
-	return bb.bus.WriteByteToReg(bb.address, register(ModuleArm)+moduleArmWristTilt, angle)
+	return bb.writeArm(moduleArmWristTilt, angle)
 }
 
 // ArmGrip commands BB to change the grip position and width, 0-180
 func (bb *BB) ArmGrip(angle byte) error {
-	// TODO: check status
-	return bb.bus.WriteByteToReg(bb.address, register(ModuleArm)+moduleArmGrip, angle)
+	return bb.writeArm(moduleArmGrip, angle)
+}
+
+///////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Speaker installed on the board, plays melodies uploaded to Speech module
+const (
+	ModuleSpeech      = C.ModuleSpeech
+	moduleSpeechReset = C.ModuleSpeechReset
+	moduleSpeechNote  = C.ModuleSpeechNote
+	commandPlayMelody = C.CommandPlayMelody
+	// MaxMelodyNotes is the max length of a melody the board can store
+	MaxMelodyNotes = C.MaxMelodyNotes
+)
+
+// Melody errors
+var (
+	ErrMelodyTooLong = errors.New("Melody has too many notes")
+	ErrInvalidNote   = errors.New("Note frequency or duration is out of range")
+)
+
+// Note of a melody: Frequency in Hz (0 for a pause) played for Duration.
+// Notes are separated by a short pause, 30% of the Duration.
+type Note struct {
+	Frequency uint16
+	Duration  time.Duration
+}
+
+// PlayMelody uploads the notes to the board and starts playing, interrupting the melody
+// currently playing (if any). It doesn't wait for the melody to finish.
+func (bb *BB) PlayMelody(notes []Note) error {
+	if len(notes) > MaxMelodyNotes {
+		return ErrMelodyTooLong
+	}
+	for _, note := range notes {
+		if note.Duration < 0 || note.Duration/time.Millisecond > 0xffff {
+			return ErrInvalidNote
+		}
+	}
+	// Another melody must not be uploaded in the middle of this one
+	return bb.session(func(bb *BB) error {
+		if err := bb.checkReady(ModuleCommand); err != nil {
+			return err
+		}
+		if err := bb.StopMelody(); err != nil {
+			return err
+		}
+		for _, note := range notes {
+			duration := uint16(note.Duration / time.Millisecond)
+			if _, err := bb.bus.WriteSliceToReg(bb.address,
+				register(ModuleSpeech)+moduleSpeechNote, []byte{
+					byte(note.Frequency >> 8), byte(note.Frequency),
+					byte(duration >> 8), byte(duration),
+				}); err != nil {
+				return err
+			}
+		}
+		return bb.bus.WriteByteToReg(bb.address, register(ModuleCommand), commandPlayMelody)
+	})
+}
+
+// StopMelody stops playing the melody and clears it
+func (bb *BB) StopMelody() error {
+	return bb.bus.WriteByteToReg(bb.address, register(ModuleSpeech)+moduleSpeechReset, 0)
+}
+
+// PlayingMelody returns true until the melody has finished playing
+func (bb *BB) PlayingMelody() (bool, error) {
+	err := bb.checkReady(ModuleSpeech)
+	if _, notReady := err.(*StatusError); notReady {
+		return true, nil
+	}
+	return false, err
 }
@@ -14,6 +14,8 @@ enum {
   MinTilt = 30,
   MaxTilt = 150,
   I2CAddress = 0x42,
+  // Max number of notes in a melody uploaded to Speech module
+  MaxMelodyNotes = 32,
 };
 
 enum {
@@ -23,6 +25,8 @@ enum {
   CommandSleep,
   // Re-attach servos
   CommandWake,
+  // Play the melody uploaded to Speech module
+  CommandPlayMelody,
 };
 
 enum {
@@ -49,6 +53,15 @@ enum {
   ModuleBoardBattery,
 };
 
+// Additions for Speech register
+enum {
+  // Write any byte to stop playing and clear the melody
+  ModuleSpeechReset,
+  // Write 4 bytes (big endian): frequency (Hz, 0 for pause) and duration (ms)
+  // to append a note to the melody
+  ModuleSpeechNote,
+};
+
 // Additions for Arm register
 enum {
   ModuleArmBasePan,
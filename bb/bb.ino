@@ -46,6 +46,11 @@ volatile byte environment_temperature, environment_humidity;
 
 volatile byte i2cRegister = 0xff;  // register to read from / write to
 
+// Melody uploaded over i2c, played in loop() while Speech is not ready
+volatile uint16_t melody[MaxMelodyNotes][2];  // frequency (Hz), duration (ms)
+volatile byte melodyLength = 0, melodyNote = 0;
+volatile unsigned long melodyNoteEnd = 0;
+
 #define MODULE_REGISTER(module) ((Module ## module) * 0x10)
 
 volatile uint16_t status = 0;
@@ -104,6 +109,26 @@ void setup() {
   MODULE_READY(LightSensor);
 
   play(PinSpeaker, melody_HappyBirthday, sizeof(melody_HappyBirthday) >> 2);
+  MODULE_READY(Speech);
+}
+
+void playMelody() {
+  if (millis() < melodyNoteEnd) {
+    return;
+  }
+  noTone(PinSpeaker);
+  if (melodyNote >= melodyLength) {
+    MODULE_READY(Speech);
+    return;
+  }
+  uint16_t frequency = melody[melodyNote][0],
+           duration = melody[melodyNote][1];
+  if (frequency) {
+    tone(PinSpeaker, frequency, duration);
+  }
+  // a short pause between the notes, like play() does
+  melodyNoteEnd = millis() + duration * 1.3;
+  melodyNote++;
 }
 
 void loop() {
@@ -113,7 +138,10 @@ void loop() {
     environment_humidity = (byte)EnvironmentSensor.readHumidity();
     MODULE_READY(EnvironmentSensor);
   }
-  delay(100);
+  if (!MODULE_ISREADY(Speech)) {
+    playMelody();
+  }
+  delay(10);
 }
 
 void boardCommand(byte value) {
@@ -130,6 +158,14 @@ void boardCommand(byte value) {
     attachTilt(true);
     attachArm(true);
     break;
+  case CommandPlayMelody:
+    if (MODULE_ISREADY(Speech)) {
+      melodyNote = 0;
+      melodyNoteEnd = 0;
+      // an indicator for the main loop()
+      MODULE_BUSY(Speech,);  // NOLINT(whitespace/comma)
+    }
+    break;
   }
 }
 
@@ -145,6 +181,20 @@ void i2cReceive(int bytesReceived) {
     case MODULE_REGISTER(Tilt):
       Tilt.write(constrain(value8, MinTilt, MaxTilt));
       break;
+    case MODULE_REGISTER(Speech) + ModuleSpeechReset:
+      melodyLength = 0;
+      melodyNote = 0;
+      noTone(PinSpeaker);
+      MODULE_READY(Speech);
+      break;
+    case MODULE_REGISTER(Speech) + ModuleSpeechNote:
+      if (bytesReceived >= 5 && melodyLength < MaxMelodyNotes) {
+        melody[melodyLength][0] = (value8 << 8) | Wire.read();
+        melody[melodyLength][1] = Wire.read() << 8;
+        melody[melodyLength][1] |= Wire.read();
+        melodyLength++;
+      }
+      break;
 
 #define SERVO_CASE_WITH_ADDITION(module, addition, value) \
     case MODULE_REGISTER(module) + Module ## module ## addition: \
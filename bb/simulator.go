@@ -0,0 +1,151 @@
+package bb
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SimulatorMeasureLatency is how long the simulated environment sensor takes to measure
+const SimulatorMeasureLatency = 300 * time.Millisecond
+
+// Simulator emulates BotBoarduino firmware registers, to be attached to sim.Bus
+type Simulator struct {
+	mu          sync.Mutex
+	status      uint16
+	measuredAt  time.Time
+	battery     uint16
+	light       uint16
+	temperature byte
+	humidity    byte
+	tilt        byte
+	arm         [moduleArmGrip + 1]byte
+	melody      []Note
+	playedAt    time.Time
+}
+
+// NewSimulator creates a simulated BotBoarduino that has just been powered on
+func NewSimulator() *Simulator {
+	s := &Simulator{
+		battery:     532,
+		light:       512,
+		temperature: 22,
+		humidity:    45,
+		tilt:        90,
+	}
+	for i := range s.arm {
+		s.arm[i] = 90
+	}
+	s.Reset()
+	return s
+}
+
+// Reset emulates board reboot, which makes all the servos detached
+func (s *Simulator) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = 1<<ModuleCommand | 1<<ModuleBoard | 1<<ModuleLightSensor | 1<<ModuleSpeech
+	s.melody = nil
+	// The firmware measures environment right after boot
+	s.measuredAt = time.Now().Add(SimulatorMeasureLatency)
+}
+
+func (s *Simulator) updateStatus() {
+	if !s.measuredAt.IsZero() && time.Now().After(s.measuredAt) {
+		s.status |= 1 << ModuleEnvironmentSensor
+		s.measuredAt = time.Time{}
+	}
+	if !s.playedAt.IsZero() && time.Now().After(s.playedAt) {
+		s.status |= 1 << ModuleSpeech
+		s.playedAt = time.Time{}
+	}
+}
+
+func (s *Simulator) command(value byte) {
+	switch value {
+	case commandMeasureEnvironment:
+		s.status &^= 1 << ModuleEnvironmentSensor
+		s.measuredAt = time.Now().Add(SimulatorMeasureLatency)
+	case commandSleep:
+		s.status &^= 1<<ModuleArm | 1<<ModuleTilt
+	case commandWake:
+		s.status |= 1<<ModuleArm | 1<<ModuleTilt
+	case commandPlayMelody:
+		if s.status&(1<<ModuleSpeech) != 0 {
+			var duration time.Duration
+			for _, note := range s.melody {
+				duration += note.Duration * 13 / 10
+			}
+			s.status &^= 1 << ModuleSpeech
+			s.playedAt = time.Now().Add(duration)
+		}
+	}
+}
+
+// Write handles a write transaction to the board
+func (s *Simulator) Write(reg byte, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.updateStatus()
+	value := data[0]
+	switch {
+	case reg == register(ModuleCommand):
+		s.command(value)
+	case reg == register(ModuleTilt):
+		if value < MinTilt {
+			value = MinTilt
+		} else if value > MaxTilt {
+			value = MaxTilt
+		}
+		s.tilt = value
+	case reg >= register(ModuleArm) && reg <= register(ModuleArm)+moduleArmGrip:
+		s.arm[reg-register(ModuleArm)] = value
+	case reg == register(ModuleSpeech)+moduleSpeechReset:
+		s.melody = nil
+		s.status |= 1 << ModuleSpeech
+		s.playedAt = time.Time{}
+	case reg == register(ModuleSpeech)+moduleSpeechNote:
+		if len(data) >= 4 && len(s.melody) < MaxMelodyNotes {
+			s.melody = append(s.melody, Note{
+				Frequency: uint16(data[0])<<8 | uint16(data[1]),
+				Duration:  time.Duration(uint16(data[2])<<8|uint16(data[3])) * time.Millisecond,
+			})
+		}
+	}
+	return nil
+}
+
+func putWord(data []byte, value uint16) int {
+	// Same byte order as writeWord() in the firmware
+	return copy(data, []byte{byte(value >> 8), byte(value)})
+}
+
+// Read handles a read transaction from the board
+func (s *Simulator) Read(reg byte, data []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.updateStatus()
+	switch reg {
+	case register(ModuleBoard) + moduleBoardStatus:
+		return putWord(data, s.status), nil
+	case register(ModuleBoard) + moduleBoardBattery:
+		return putWord(data, s.battery), nil
+	case register(ModuleLightSensor):
+		return putWord(data, s.light), nil
+	case register(ModuleEnvironmentSensor) + moduleEnvironmentSensorTemperature:
+		return copy(data, []byte{s.temperature}), nil
+	case register(ModuleEnvironmentSensor) + moduleEnvironmentSensorHumidity:
+		return copy(data, []byte{s.humidity}), nil
+	}
+	return 0, fmt.Errorf("Register 0x%.2x is not readable", reg)
+}
+
+// Tilt returns the current simulated Tilt servo angle
+func (s *Simulator) Tilt() byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tilt
+}
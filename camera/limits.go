@@ -0,0 +1,30 @@
+package camera
+
+import "sync"
+
+// Limits caps the capture size and frame rate requested by clients, e.g. to save power.
+// Zero value means no limits.
+type Limits struct {
+	mu                 sync.Mutex
+	width, height, fps int
+}
+
+// Set the max width, height and fps; zero disables the corresponding limit
+func (l *Limits) Set(width, height, fps int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.width, l.height, l.fps = width, height, fps
+}
+
+func (l *Limits) apply(width, height, fps *int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limit := func(value *int, max int) {
+		if max > 0 && *value > max {
+			*value = max
+		}
+	}
+	limit(width, l.width)
+	limit(height, l.height)
+	limit(fps, l.fps)
+}
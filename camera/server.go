@@ -6,11 +6,19 @@ import (
 	"net/http"
 	"path/filepath"
 	"strconv"
+
+	"github.com/dasfoo/rover/auth"
 )
 
 // Server allows serving video stream and pictures over HTTP.
 type Server struct {
-	ValidatePassword func(string) error
+	// ValidatePassword returns nil if the password grants the level of access to the request
+	ValidatePassword func(r *http.Request, password string, level auth.Level) error
+	// PictureLevel and VideoLevel are required to capture, auth.Viewer if not set
+	PictureLevel auth.Level
+	VideoLevel   auth.Level
+	// Limits is optional, caps the capture requested by clients
+	Limits *Limits
 }
 
 type request struct {
@@ -37,11 +45,44 @@ func (r *request) getIntHeader(header string, intValue *int) bool {
 	return true
 }
 
+// requiredLevel returns the access level for the capture requested: a picture for ".jpg"
+// paths or zero FPS header, a video otherwise. If the FPS header is malformed, the higher
+// of the two levels is required, and the request is rejected after the password check.
+func (s *Server) requiredLevel(r *http.Request) auth.Level {
+	pictureLevel, videoLevel := s.PictureLevel, s.VideoLevel
+	if pictureLevel == 0 {
+		pictureLevel = auth.Viewer
+	}
+	if videoLevel == 0 {
+		videoLevel = auth.Viewer
+	}
+	picture := filepath.Ext(r.URL.Path) == ".jpg"
+	if value := r.Header.Get("X-Capture-Server-FPS"); value != "" {
+		fps, e := strconv.Atoi(value)
+		if e != nil {
+			if pictureLevel > videoLevel {
+				return pictureLevel
+			}
+			return videoLevel
+		}
+		picture = fps == 0
+	}
+	if picture {
+		return pictureLevel
+	}
+	return videoLevel
+}
+
 // Handler replies to the client request for camera pictures or video.
 func (s *Server) Handler(w http.ResponseWriter, r *http.Request) {
 	req := &request{r: r, w: w}
 
-	if s.ValidatePassword(r.Header.Get("X-Capture-Server-PASSWORD")) != nil {
+	switch s.ValidatePassword(r, r.Header.Get("X-Capture-Server-PASSWORD"), s.requiredLevel(r)) {
+	case nil:
+	case auth.ErrLockedOut:
+		req.renderError(http.StatusTooManyRequests, "429 Too Many Requests")
+		return
+	default:
 		req.renderError(http.StatusForbidden, "403 Forbidden")
 		return
 	}
@@ -74,6 +115,10 @@ func (s *Server) Handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if s.Limits != nil {
+		s.Limits.apply(&width, &height, &fps)
+	}
+
 	var capturer *Process
 
 	w.Header().Set("Server", "Go (raspivid/raspistill)")
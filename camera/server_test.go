@@ -0,0 +1,62 @@
+package camera
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dasfoo/rover/auth"
+)
+
+func TestHandlerChecksPasswordFirst(t *testing.T) {
+	var checked []auth.Level
+	s := &Server{
+		ValidatePassword: func(r *http.Request, password string, level auth.Level) error {
+			checked = append(checked, level)
+			if password != "secret" {
+				return auth.ErrIncorrectToken
+			}
+			return nil
+		},
+		PictureLevel: auth.Viewer,
+		VideoLevel:   auth.Operator,
+	}
+	for _, test := range []struct {
+		path     string
+		headers  map[string]string
+		wantCode int
+		level    auth.Level
+	}{
+		{"/video.h264", map[string]string{"X-Capture-Server-FPS": "abc"},
+			http.StatusForbidden, auth.Operator},
+		{"/picture.jpg", map[string]string{"X-Capture-Server-QUALITY": "abc"},
+			http.StatusForbidden, auth.Viewer},
+		{"/picture.jpg", map[string]string{"X-Capture-Server-FPS": "10"},
+			http.StatusForbidden, auth.Operator},
+		{"/video.h264", map[string]string{"X-Capture-Server-FPS": "0"},
+			http.StatusForbidden, auth.Viewer},
+		{"/video.h264", map[string]string{
+			"X-Capture-Server-FPS":      "abc",
+			"X-Capture-Server-PASSWORD": "secret",
+		}, http.StatusBadRequest, auth.Operator},
+		{"/picture.jpg", map[string]string{
+			"X-Capture-Server-QUALITY":  "abc",
+			"X-Capture-Server-PASSWORD": "secret",
+		}, http.StatusBadRequest, auth.Viewer},
+	} {
+		checked = nil
+		r := httptest.NewRequest("GET", test.path, nil)
+		for header, value := range test.headers {
+			r.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		s.Handler(w, r)
+		if w.Code != test.wantCode {
+			t.Errorf("%s %v: code %d, want %d", test.path, test.headers, w.Code, test.wantCode)
+		}
+		if len(checked) != 1 || checked[0] != test.level {
+			t.Errorf("%s %v: checked levels %v, want %v", test.path, test.headers, checked,
+				test.level)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package guard
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/dasfoo/rover/scan"
+)
+
+// Defaults for Config
+const (
+	DefaultStopDistance = 30
+	DefaultSlowDistance = 100
+	DefaultMaxAge       = 200 * time.Millisecond
+)
+
+// ErrStale is returned when the sensor gives a distance older than Config.MaxAge,
+// e.g. the latest forward point of a sweep in progress
+var ErrStale = errors.New("Distance measurement is too old")
+
+// Sensor measures distance in front of the rover, e.g. scan.Scanner
+type Sensor interface {
+	Forward(ctx context.Context) (scan.Point, error)
+}
+
+// Config of the Guard
+type Config struct {
+	// StopDistance in centimeters, below which moving forward is refused
+	StopDistance uint16
+	// SlowDistance in centimeters, below which forward speed is reduced proportionally
+	SlowDistance uint16
+	// MaxAge of the distance measurement, older ones are refreshed
+	MaxAge time.Duration
+}
+
+// DefaultConfig is used by NewGuard when zero config is provided
+var DefaultConfig = Config{
+	StopDistance: DefaultStopDistance,
+	SlowDistance: DefaultSlowDistance,
+	MaxAge:       DefaultMaxAge,
+}
+
+// Limit describes what the Guard did to the motor speeds
+type Limit struct {
+	// Limited is true if the speeds have been reduced
+	Limited bool
+	// Reason is a human readable explanation of the limit
+	Reason string
+	// Distance to the obstacle in centimeters, 0 if unknown
+	Distance uint16
+}
+
+// Guard limits forward speed of the rover when an obstacle is close
+type Guard struct {
+	sensor Sensor
+	config Config
+
+	mu     sync.Mutex
+	latest scan.Point
+	// measuring is closed when the measurement in progress is done, nil if none
+	measuring chan struct{}
+}
+
+// NewGuard creates a Guard which takes forward distance from the sensor
+func NewGuard(sensor Sensor, config Config) *Guard {
+	if config == (Config{}) {
+		config = DefaultConfig
+	}
+	return &Guard{
+		sensor: sensor,
+		config: config,
+	}
+}
+
+// distance returns forward distance, measuring it again if the latest one is too old.
+// Concurrent callers wait for the same measurement, without blocking the Guard.
+func (g *Guard) distance(ctx context.Context) (uint16, error) {
+	for {
+		g.mu.Lock()
+		if time.Since(g.latest.Time) <= g.config.MaxAge {
+			distance := g.latest.Distance
+			g.mu.Unlock()
+			return distance, nil
+		}
+		if measuring := g.measuring; measuring != nil {
+			g.mu.Unlock()
+			select {
+			case <-measuring:
+				continue
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			}
+		}
+		measuring := make(chan struct{})
+		g.measuring = measuring
+		g.mu.Unlock()
+
+		point, err := g.sensor.Forward(ctx)
+		if err == nil && time.Since(point.Time) > g.config.MaxAge {
+			err = ErrStale
+		}
+
+		g.mu.Lock()
+		g.measuring = nil
+		close(measuring)
+		if err == nil {
+			g.latest = point
+		}
+		g.mu.Unlock()
+		if err != nil {
+			return 0, err
+		}
+		return point.Distance, nil
+	}
+}
+
+// Limit returns motor speeds reduced according to the distance in front of the rover.
+// Turning in place and moving backwards are never limited. If the distance can't be
+// measured, moving forward is refused.
+func (g *Guard) Limit(ctx context.Context, left, right int8) (int8, int8, Limit) {
+	// Forward component of the movement, the rest is rotation
+	forward := (int(left) + int(right)) / 2
+	if forward <= 0 {
+		return left, right, Limit{}
+	}
+	distance, err := g.distance(ctx)
+	if err != nil {
+		return left - int8(forward), right - int8(forward), Limit{
+			Limited: true,
+			Reason:  fmt.Sprintf("Distance to obstacles is unknown: %s", err),
+		}
+	}
+	if distance >= g.config.SlowDistance {
+		return left, right, Limit{Distance: distance}
+	}
+	limited := 0
+	if distance > g.config.StopDistance {
+		limited = forward * int(distance-g.config.StopDistance) /
+			int(g.config.SlowDistance-g.config.StopDistance)
+	}
+	limit := Limit{
+		Limited:  true,
+		Distance: distance,
+	}
+	if limited == 0 {
+		limit.Reason = fmt.Sprintf("Obstacle ahead at %dcm, stopped", distance)
+	} else {
+		limit.Reason = fmt.Sprintf("Obstacle ahead at %dcm, slowed down", distance)
+	}
+	return left - int8(forward-limited), right - int8(forward-limited), limit
+}
@@ -0,0 +1,146 @@
+package guard
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/dasfoo/rover/scan"
+)
+
+// fakeSensor returns the distance measured age ago, and counts measurements
+type fakeSensor struct {
+	mu       sync.Mutex
+	distance uint16
+	age      time.Duration
+	err      error
+	calls    int
+	// release, if set, blocks measurements until closed
+	release chan struct{}
+}
+
+func (f *fakeSensor) Forward(ctx context.Context) (scan.Point, error) {
+	f.mu.Lock()
+	f.calls++
+	release := f.release
+	f.mu.Unlock()
+	if release != nil {
+		<-release
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return scan.Point{
+		Angle:    scan.ForwardTilt,
+		Distance: f.distance,
+		Time:     time.Now().Add(-f.age),
+	}, f.err
+}
+
+func (f *fakeSensor) measured() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func TestLimit(t *testing.T) {
+	for _, test := range []struct {
+		distance              uint16
+		left, right           int8
+		wantLeft, wantRight   int8
+		limited, wantMeasured bool
+	}{
+		{200, 60, 60, 60, 60, false, true},
+		{100, 60, 60, 60, 60, false, true},
+		{65, 60, 60, 30, 30, true, true},
+		{65, 80, 40, 50, 10, true, true},
+		{30, 60, 60, 0, 0, true, true},
+		{10, 60, 60, 0, 0, true, true},
+		{10, 90, 30, 30, -30, true, true},
+		// Backwards and turning in place are never limited
+		{10, -60, -60, -60, -60, false, false},
+		{10, -40, 40, -40, 40, false, false},
+	} {
+		sensor := &fakeSensor{distance: test.distance}
+		g := NewGuard(sensor, Config{})
+		left, right, limit := g.Limit(context.Background(), test.left, test.right)
+		if left != test.wantLeft || right != test.wantRight || limit.Limited != test.limited {
+			t.Errorf("Limit(%d, %d) at %dcm = %d, %d, %+v, want %d, %d, limited %v",
+				test.left, test.right, test.distance, left, right, limit,
+				test.wantLeft, test.wantRight, test.limited)
+		}
+		if measured := sensor.measured() > 0; measured != test.wantMeasured {
+			t.Errorf("Limit(%d, %d) measured distance: %v", test.left, test.right, measured)
+		}
+	}
+}
+
+func TestLimitUnknownDistance(t *testing.T) {
+	for _, sensor := range []*fakeSensor{
+		{distance: 500, err: errors.New("no signal")},
+		// A sweep in progress gives an old forward point
+		{distance: 500, age: 2 * DefaultMaxAge},
+	} {
+		g := NewGuard(sensor, Config{})
+		left, right, limit := g.Limit(context.Background(), 70, 50)
+		if left != 10 || right != -10 || !limit.Limited ||
+			!strings.HasPrefix(limit.Reason, "Distance to obstacles is unknown") {
+			t.Errorf("Limit without distance (%v, age %s) = %d, %d, %+v, want forward "+
+				"movement removed", sensor.err, sensor.age, left, right, limit)
+		}
+	}
+}
+
+func TestLimitReusesRecentDistance(t *testing.T) {
+	sensor := &fakeSensor{distance: 200}
+	g := NewGuard(sensor, Config{StopDistance: 30, SlowDistance: 100, MaxAge: time.Hour})
+	for i := 0; i < 3; i++ {
+		g.Limit(context.Background(), 60, 60)
+	}
+	if calls := sensor.measured(); calls != 1 {
+		t.Errorf("Distance measured %d times, want once within MaxAge", calls)
+	}
+
+	sensor = &fakeSensor{distance: 200}
+	g = NewGuard(sensor, Config{StopDistance: 30, SlowDistance: 100, MaxAge: time.Millisecond})
+	g.Limit(context.Background(), 60, 60)
+	time.Sleep(5 * time.Millisecond)
+	g.Limit(context.Background(), 60, 60)
+	if calls := sensor.measured(); calls != 2 {
+		t.Errorf("Distance measured %d times, want it measured again after MaxAge", calls)
+	}
+}
+
+func TestLimitSharesMeasurement(t *testing.T) {
+	sensor := &fakeSensor{distance: 65, release: make(chan struct{})}
+	g := NewGuard(sensor, Config{})
+	const callers = 5
+	results := make(chan int8, callers)
+	for i := 0; i < callers; i++ {
+		go func() {
+			left, _, _ := g.Limit(context.Background(), 60, 60)
+			results <- left
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	// A caller giving up doesn't wait for the measurement in progress
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if left, _, limit := g.Limit(ctx, 60, 60); left != 0 || !limit.Limited {
+		t.Errorf("Limit with cancelled context = %d, %+v, want stopped", left, limit)
+	}
+
+	close(sensor.release)
+	for i := 0; i < callers; i++ {
+		if left := <-results; left != 30 {
+			t.Errorf("Limit = %d, want 30", left)
+		}
+	}
+	if calls := sensor.measured(); calls != 1 {
+		t.Errorf("Distance measured %d times, want concurrent callers to share it", calls)
+	}
+}
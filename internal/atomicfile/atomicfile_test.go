@@ -0,0 +1,42 @@
+package atomicfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atomicfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	filename := filepath.Join(dir, "file")
+	for _, data := range []string{"first version\n", "second"} {
+		if err = WriteFile(filename, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+		var b []byte
+		if b, err = ioutil.ReadFile(filename); err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != data {
+			t.Errorf("Read %q, want %q", b, data)
+		}
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("File mode is %v, want readable only by the owner", info.Mode())
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("Temporary files left behind: %d files in the directory", len(files))
+	}
+	if err = WriteFile(filepath.Join(dir, "missing", "file"), nil); err == nil {
+		t.Error("WriteFile into a missing directory should fail")
+	}
+}
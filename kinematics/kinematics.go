@@ -0,0 +1,156 @@
+package kinematics
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math"
+
+	"github.com/dasfoo/rover/arm"
+	"github.com/dasfoo/rover/bb"
+)
+
+// Error definitions
+var (
+	ErrUnreachable   = errors.New("The position is out of the arm reach")
+	ErrInvalidConfig = errors.New("Arm link lengths must be positive and joint scales non-zero")
+)
+
+// Joint maps a joint angle to the servo angle: servo = Offset + Scale * joint (degrees)
+type Joint struct {
+	Offset float64
+	Scale  float64
+}
+
+func (j Joint) servo(radians float64) (byte, error) {
+	angle := j.Offset + j.Scale*radians*180/math.Pi
+	if angle < -0.5 || angle > bb.MaxAngle+0.5 || math.IsNaN(angle) {
+		return 0, ErrUnreachable
+	}
+	return byte(math.Max(0, angle) + 0.5), nil
+}
+
+func (j Joint) joint(servo byte) float64 {
+	return (float64(servo) - j.Offset) / j.Scale * math.Pi / 180
+}
+
+// Config describes the arm geometry, lengths in meters.
+// Joint angles are: BasePan around vertical axis, 0 is straight ahead, counter-clockwise;
+// BaseTilt from horizontal, up; Elbow and WristTilt relative to the previous link, up.
+type Config struct {
+	// BaseHeight is the height of BaseTilt axis above the origin
+	BaseHeight float64
+	// Humerus is the distance from BaseTilt to Elbow axis
+	Humerus float64
+	// Forearm is the distance from Elbow to WristTilt axis
+	Forearm float64
+	// Hand is the distance from WristTilt axis to the gripper tip
+	Hand float64
+
+	BasePan   Joint
+	BaseTilt  Joint
+	Elbow     Joint
+	WristTilt Joint
+}
+
+// DefaultConfig matches Lynxmotion AL5D arm installed on the rover
+var DefaultConfig = Config{
+	BaseHeight: 0.07,
+	Humerus:    0.146,
+	Forearm:    0.187,
+	Hand:       0.1,
+	BasePan:    Joint{Offset: 90, Scale: 1},
+	BaseTilt:   Joint{Offset: 0, Scale: 1},
+	Elbow:      Joint{Offset: 180, Scale: 1},
+	WristTilt:  Joint{Offset: 90, Scale: 1},
+}
+
+// Validate returns ErrInvalidConfig unless the link lengths are positive and the joint
+// scales are non-zero, which Inverse and Forward divide by
+func (c Config) Validate() error {
+	if !(c.Humerus > 0 && c.Forearm > 0 && c.Hand > 0) {
+		return ErrInvalidConfig
+	}
+	for _, j := range []Joint{c.BasePan, c.BaseTilt, c.Elbow, c.WristTilt} {
+		if j.Scale == 0 {
+			return ErrInvalidConfig
+		}
+	}
+	return nil
+}
+
+// LoadConfig reads Config from a JSON file; missing fields are taken from DefaultConfig
+func LoadConfig(filename string) (*Config, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	c := DefaultConfig
+	if err = json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+	if err = c.Validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Position of the gripper tip relative to the arm origin, in meters, and gripper Pitch
+// in degrees from horizontal (negative is pointing down).
+type Position struct {
+	X, Y, Z, Pitch float64
+}
+
+// Inverse computes the pose which brings the gripper to the position requested.
+// WristRotate and Grip are copied from current pose as they don't affect the position.
+func (c *Config) Inverse(p Position, current arm.Pose) (arm.Pose, error) {
+	pitch := p.Pitch * math.Pi / 180
+	pan := math.Atan2(p.Y, p.X)
+	// Wrist position in the vertical plane of the arm
+	r := math.Hypot(p.X, p.Y) - c.Hand*math.Cos(pitch)
+	z := p.Z - c.BaseHeight - c.Hand*math.Sin(pitch)
+
+	cosElbow := (r*r + z*z - c.Humerus*c.Humerus - c.Forearm*c.Forearm) /
+		(2 * c.Humerus * c.Forearm)
+	if cosElbow < -1 || cosElbow > 1 {
+		return current, ErrUnreachable
+	}
+	// Elbow up: the forearm bends down from the humerus
+	elbow := -math.Acos(cosElbow)
+	tilt := math.Atan2(z, r) + math.Atan2(c.Forearm*math.Sin(-elbow),
+		c.Humerus+c.Forearm*math.Cos(elbow))
+	wrist := pitch - tilt - elbow
+
+	pose := current
+	var err error
+	if pose.BasePan, err = c.BasePan.servo(pan); err != nil {
+		return current, err
+	}
+	if pose.BaseTilt, err = c.BaseTilt.servo(tilt); err != nil {
+		return current, err
+	}
+	if pose.Elbow, err = c.Elbow.servo(elbow); err != nil {
+		return current, err
+	}
+	if pose.WristTilt, err = c.WristTilt.servo(wrist); err != nil {
+		return current, err
+	}
+	return pose, nil
+}
+
+// Forward computes the gripper position for the pose
+func (c *Config) Forward(pose arm.Pose) Position {
+	pan := c.BasePan.joint(pose.BasePan)
+	tilt := c.BaseTilt.joint(pose.BaseTilt)
+	elbow := tilt + c.Elbow.joint(pose.Elbow)
+	pitch := elbow + c.WristTilt.joint(pose.WristTilt)
+
+	r := c.Humerus*math.Cos(tilt) + c.Forearm*math.Cos(elbow) + c.Hand*math.Cos(pitch)
+	z := c.Humerus*math.Sin(tilt) + c.Forearm*math.Sin(elbow) + c.Hand*math.Sin(pitch)
+	return Position{
+		X:     r * math.Cos(pan),
+		Y:     r * math.Sin(pan),
+		Z:     c.BaseHeight + z,
+		Pitch: pitch * 180 / math.Pi,
+	}
+}
@@ -0,0 +1,63 @@
+package kinematics
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/dasfoo/rover/arm"
+)
+
+func TestLoadConfigValidates(t *testing.T) {
+	f, err := ioutil.TempFile("", "arm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+	_ = f.Close()
+	for _, test := range []struct {
+		json string
+		err  error
+	}{
+		{`{}`, nil},
+		{`{"Hand": 0.05, "Elbow": {"Offset": 170, "Scale": -1}}`, nil},
+		{`{"Humerus": 0}`, ErrInvalidConfig},
+		{`{"Forearm": -0.1}`, ErrInvalidConfig},
+		{`{"Hand": 0}`, ErrInvalidConfig},
+		{`{"WristTilt": {"Offset": 90, "Scale": 0}}`, ErrInvalidConfig},
+	} {
+		if err = ioutil.WriteFile(f.Name(), []byte(test.json), 0600); err != nil {
+			t.Fatal(err)
+		}
+		c, err := LoadConfig(f.Name())
+		if err != test.err {
+			t.Errorf("LoadConfig(%s) error = %v, want %v", test.json, err, test.err)
+		}
+		if (c == nil) != (test.err != nil) {
+			t.Errorf("LoadConfig(%s) = %+v", test.json, c)
+		}
+	}
+}
+
+func TestInverseForward(t *testing.T) {
+	c := DefaultConfig
+	for _, p := range []Position{
+		{X: 0.25, Y: 0, Z: 0.1, Pitch: 0},
+		{X: 0.15, Y: 0.1, Z: 0.05, Pitch: -30},
+	} {
+		pose, err := c.Inverse(p, arm.Pose{})
+		if err != nil {
+			t.Fatalf("Inverse(%+v) = %v", p, err)
+		}
+		got := c.Forward(pose)
+		// Servo angles are whole degrees
+		if math.Abs(got.X-p.X) > 0.01 || math.Abs(got.Y-p.Y) > 0.01 ||
+			math.Abs(got.Z-p.Z) > 0.01 || math.Abs(got.Pitch-p.Pitch) > 3 {
+			t.Errorf("Forward(Inverse(%+v)) = %+v", p, got)
+		}
+	}
+	if _, err := c.Inverse(Position{X: 1}, arm.Pose{}); err != ErrUnreachable {
+		t.Errorf("Inverse of a far position = %v, want ErrUnreachable", err)
+	}
+}
@@ -3,35 +3,73 @@ package main
 import (
 	"errors"
 	"flag"
+	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"os"
+	"os/exec"
 	"os/user"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/dasfoo/i2c"
+	"github.com/dasfoo/lidar-lite-v2"
+	"github.com/dasfoo/rover/arbiter"
+	"github.com/dasfoo/rover/arm"
 	"github.com/dasfoo/rover/auth"
+	"github.com/dasfoo/rover/battery"
 	"github.com/dasfoo/rover/bb"
 	"github.com/dasfoo/rover/camera"
+	"github.com/dasfoo/rover/guard"
+	"github.com/dasfoo/rover/kinematics"
 	"github.com/dasfoo/rover/mc"
+	"github.com/dasfoo/rover/motion"
 	"github.com/dasfoo/rover/network"
+	"github.com/dasfoo/rover/odometry"
+	"github.com/dasfoo/rover/power"
 	"github.com/dasfoo/rover/rpc"
+	"github.com/dasfoo/rover/scan"
+	"github.com/dasfoo/rover/sim"
+	"github.com/dasfoo/rover/supervisor"
+	"github.com/dasfoo/rover/telemetry"
 	"golang.org/x/net/context"
 
 	dns "google.golang.org/api/dns/v1"
 )
 
 var (
-	board  *bb.BB
-	motors *mc.MC
+	busArbiter  *arbiter.Arbiter
+	board       *bb.BB
+	batteries   *battery.Monitor
+	powerPolicy *power.Policy
+	cameraLimit = &camera.Limits{}
+	roboticArm  *arm.Arm
+	armGeometry *kinematics.Config
+	armLibrary  *arm.Library
+	motors      *mc.MC
+	odo         *odometry.Odometry
+	mover       *motion.Controller
+	scanner     *scan.Scanner
+	obstacles   *guard.Guard
+	poller      *telemetry.Poller
+	boardHealth *supervisor.Supervisor
+
+	// boardSimulator is set in testing mode, to simulate sensors attached to the Board
+	boardSimulator *bb.Simulator
 
 	testMode = flag.Bool("test", false,
 		"Testing mode (running application from dev environment)")
 	listenAddress = flag.String("listen", "",
 		"Listen address: [<ip>]:<port>")
+	authBackend = flag.String("auth_backend", "gcs",
+		"Where to get authorization data from: gcs (-gcs_bucket), "+
+			"dir (-auth_path directory with a token file per user), "+
+			"htpasswd (-auth_path file with bcrypt hashed tokens) or none")
+	authPath = flag.String("auth_path", "",
+		"Directory or file with authorization data for -auth_backend dir or htpasswd")
 	gcsBucket = flag.String("gcs_bucket", "",
 		"Name of GCS bucket containing authorization data")
 	domainsString = flag.String("domains", "",
@@ -39,6 +77,40 @@ var (
 			"but TLS certificate will be obtained for all of them")
 	cloudDNSZone = flag.String("cloud_dns_zone", "",
 		"Google Cloud DNS Zone name for DNS updates")
+	batteryConfig = flag.String("battery_config", "",
+		"JSON file with battery voltage calibration and discharge curve (built-in defaults if empty)")
+	batteryLow = flag.Float64("battery_low", power.DefaultConfig.Low,
+		"Battery percentage below which camera resolution is reduced")
+	batteryCritical = flag.Float64("battery_critical", power.DefaultConfig.Critical,
+		"Battery percentage below which the rover stops, parks the arm and sleeps")
+	batteryShutdown = flag.Float64("battery_shutdown", power.DefaultConfig.Shutdown,
+		"Battery percentage below which the system shuts down")
+	shutdownCommand = flag.String("shutdown_command", "",
+		"Command to shut down the system when the battery is exhausted, e.g. "+
+			"\"sudo shutdown -h now\" (disabled if empty; calibrate -battery_config first)")
+	armConfig = flag.String("arm_config", "",
+		"JSON file with robotic arm geometry for kinematics (built-in defaults if empty)")
+	armLibraryFile = flag.String("arm_library", "",
+		"JSON file with named robotic arm poses and sequences "+
+			"(default $HOME/.config/rover/arm.json)")
+	wheelDiameter = flag.Float64("wheel_diameter", odometry.DefaultConfig.WheelDiameter,
+		"Wheel diameter for odometry, in meters")
+	ticksPerRevolution = flag.Float64("ticks_per_revolution",
+		odometry.DefaultConfig.TicksPerRevolution,
+		"Number of encoder steps per wheel revolution for odometry")
+	trackWidth = flag.Float64("track_width", odometry.DefaultConfig.TrackWidth,
+		"Distance between left and right wheels for odometry, in meters")
+	maxAcceleration = flag.Float64("max_acceleration", 180,
+		"Max motor acceleration, speed units per second (0 for no limit)")
+	maxDeceleration = flag.Float64("max_deceleration", 360,
+		"Max motor deceleration, speed units per second (0 for no limit)")
+	stopDistance = flag.Uint("stop_distance", guard.DefaultStopDistance,
+		"Refuse to drive forward when LIDAR distance is below this, in centimeters "+
+			"(0 disables obstacle guard)")
+	slowDistance = flag.Uint("slow_distance", guard.DefaultSlowDistance,
+		"Reduce forward speed when LIDAR distance is below this, in centimeters")
+	driveTimeout = flag.Duration("drive_timeout", rpc.DefaultDriveTimeout,
+		"Stop the motors if no drive command is received within this interval")
 
 	domains []string
 	am      *auth.Manager
@@ -64,6 +136,130 @@ func updateDNS(ip string) error {
 		}, true)
 }
 
+// newBus opens i2c bus the Arduinos are connected to, or a simulated one in testing mode
+func newBus() (i2c.Bus, error) {
+	if *testMode {
+		bus := sim.NewBus()
+		boardSimulator = bb.NewSimulator()
+		bus.Attach(bb.Address, boardSimulator)
+		bus.Attach(mc.Address, mc.NewSimulator())
+		return bus, nil
+	}
+	return i2c.NewBus(1)
+}
+
+// resetBoard pulses the board reset pin, or reboots the simulated board in testing mode
+func resetBoard() {
+	if *testMode {
+		boardSimulator.Reset()
+		return
+	}
+	board.Reset(bb.ResetPin)
+}
+
+// newRangefinder returns LIDAR on the bus, or a simulated one in testing mode
+func newRangefinder(bus i2c.Bus) scan.Rangefinder {
+	if *testMode {
+		return &sim.Rangefinder{
+			Tilt:   boardSimulator.Tilt,
+			Height: 20,
+			Range:  400,
+		}
+	}
+	return lidar.NewLidar(bus, lidar.DefaultAddress)
+}
+
+// newAuthBackend creates the backend selected by -auth_backend, or nil to disable auth.
+// Writable backend is requested by the "user" command to store credentials.
+func newAuthBackend(writable bool) (auth.Backend, error) {
+	switch *authBackend {
+	case "gcs":
+		if *gcsBucket == "" {
+			return nil, nil
+		}
+		if writable {
+			return auth.NewWritableGCSBackend(context.Background(), *gcsBucket)
+		}
+		return auth.NewGCSBackend(context.Background(), *gcsBucket)
+	case "dir", "htpasswd":
+		if *authPath == "" {
+			return nil, errors.New("No -auth_path provided")
+		}
+		if *authBackend == "dir" {
+			return auth.NewDirBackend(*authPath), nil
+		}
+		return auth.NewHtpasswdBackend(*authPath), nil
+	case "none":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("Unknown auth backend: %s", *authBackend)
+}
+
+// parkDuration is how long it takes to park the arm when the battery is low
+const parkDuration = 2 * time.Second
+
+// setupPowerPolicy configures actions taken to save the battery
+func setupPowerPolicy() {
+	powerPolicy = power.NewPolicy(batteries, power.Config{
+		Low:        *batteryLow,
+		Critical:   *batteryCritical,
+		Shutdown:   *batteryShutdown,
+		Hysteresis: power.DefaultConfig.Hysteresis,
+	})
+	powerPolicy.On(power.Low, power.Action{
+		Name: "lower camera resolution",
+		Enter: func() error {
+			cameraLimit.Set(640, 480, 10)
+			return nil
+		},
+		Leave: func() error {
+			cameraLimit.Set(0, 0, 0)
+			return nil
+		},
+	})
+	powerPolicy.On(power.Critical, power.Action{
+		Name: "stop motors",
+		Enter: func() error {
+			mover.Stop()
+			return motors.Stop()
+		},
+	})
+	powerPolicy.On(power.Critical, power.Action{
+		Name: "park arm",
+		Enter: func() error {
+			pose, err := armLibrary.Pose("park")
+			if err != nil {
+				return err
+			}
+			return roboticArm.Move(context.Background(), pose, parkDuration)
+		},
+	})
+	powerPolicy.On(power.Critical, power.Action{
+		Name:  "sleep board",
+		Enter: board.Sleep,
+		Leave: board.Wake,
+	})
+	powerPolicy.On(power.Critical, power.Action{
+		Name:  "sleep motors",
+		Enter: motors.Sleep,
+		Leave: motors.Wake,
+	})
+	command := strings.Fields(*shutdownCommand)
+	if len(command) == 0 {
+		return
+	}
+	powerPolicy.On(power.Shutdown, power.Action{
+		Name: "shut down",
+		Enter: func() error {
+			if *testMode {
+				log.Println("Not shutting down in testing mode:", *shutdownCommand)
+				return nil
+			}
+			return exec.Command(command[0], command[1:]...).Run()
+		},
+	})
+}
+
 // https://github.com/grpc/grpc-go/issues/106#issuecomment-246978683
 func routingHandler(grpcHandler http.Handler, otherHandler http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -99,22 +295,59 @@ func startForwarding() error {
 	return err
 }
 
+// setupArm loads robotic arm geometry and library of poses
+func setupArm() error {
+	var err error
+	if *armConfig == "" {
+		armGeometry = &kinematics.DefaultConfig
+	} else if armGeometry, err = kinematics.LoadConfig(*armConfig); err != nil {
+		return err
+	}
+	if *armLibraryFile == "" {
+		usr, usre := user.Current()
+		if usre != nil {
+			return usre
+		}
+		*armLibraryFile = filepath.Join(usr.HomeDir, ".config/rover/arm.json")
+	}
+	armLibrary, err = arm.LoadLibrary(*armLibraryFile)
+	return err
+}
+
 func startServer() error {
 	httpSrv := &http.Server{
 		Addr: *listenAddress,
 		Handler: routingHandler(
 			(&rpc.Server{
-				AM:     am,
-				Motors: motors,
-				Board:  board,
+				AM:           am,
+				Motors:       motors,
+				Board:        board,
+				Power:        powerPolicy,
+				Battery:      batteries,
+				Arm:          roboticArm,
+				Kinematics:   armGeometry,
+				ArmLibrary:   armLibrary,
+				Odometry:     odo,
+				Motion:       mover,
+				Scanner:      scanner,
+				Guard:        obstacles,
+				Telemetry:    poller,
+				Bus:          busArbiter,
+				BoardHealth:  boardHealth,
+				DriveTimeout: *driveTimeout,
 			}).CreateGRPCServer(),
 			http.HandlerFunc((&camera.Server{
-				ValidatePassword: func(password string) error {
+				Limits: cameraLimit,
+				ValidatePassword: func(r *http.Request, password string,
+					level auth.Level) error {
 					userAndToken := strings.Split(password, ":")
 					if len(userAndToken) != 2 {
-						return errors.New("Invalid password format")
+						err := errors.New("Invalid password format")
+						am.Audit(r.RemoteAddr, r.URL.Path, "", level, err)
+						return err
 					}
-					return am.CheckAccess(userAndToken[0], userAndToken[1])
+					return am.Authorize(r.RemoteAddr, r.URL.Path,
+						userAndToken[0], userAndToken[1], level)
 				},
 			}).Handler)),
 	}
@@ -150,6 +383,13 @@ func main() {
 
 	flag.Parse()
 
+	if flag.Arg(0) == "user" {
+		if err := runUserCommand(flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	if *testMode {
 		log.Println("*** THE APPLICATION IS RUNNING IN TESTING MODE ***")
 	}
@@ -159,21 +399,74 @@ func main() {
 		domains = domains[:0]
 	}
 
-	if bus, err := i2c.NewBus(1); err != nil {
+	if rawBus, err := newBus(); err != nil {
 		log.Fatal(err)
 	} else {
 		// Silence i2c bus log
-		//bus.SetLogger(func(string, ...interface{}) {})
+		//rawBus.SetLogger(func(string, ...interface{}) {})
+
+		// gRPC handlers and background loops use the bus concurrently
+		busArbiter = arbiter.NewArbiter(rawBus)
+		bus := busArbiter.Bus()
 
 		board = bb.NewBB(bus, bb.Address)
+		roboticArm = arm.NewArm(board)
 		motors = mc.NewMC(bus, mc.Address)
+		scanner = scan.NewScanner(board, newRangefinder(bus))
+	}
+	if *stopDistance > 0 {
+		obstacles = guard.NewGuard(scanner, guard.Config{
+			StopDistance: uint16(*stopDistance),
+			SlowDistance: uint16(*slowDistance),
+			MaxAge:       guard.DefaultMaxAge,
+		})
+	}
+	ramp := mc.Ramp{
+		Acceleration: *maxAcceleration,
+		Deceleration: *maxDeceleration,
+	}
+	motors.SetRamp(ramp, ramp)
+
+	var err error
+	batteryCalibration := &battery.DefaultConfig
+	if *batteryConfig != "" {
+		if batteryCalibration, err = battery.LoadConfig(*batteryConfig); err != nil {
+			log.Fatal("Can't load battery config:", err)
+		}
+	}
+	if batteries, err = battery.NewMonitor(board, *batteryCalibration); err != nil {
+		log.Fatal("Invalid battery config:", err)
 	}
 
-	var ame error
-	am, ame = auth.NewManager(context.Background(), *gcsBucket)
-	if ame != nil {
-		log.Fatal("Can't initialize auth manager:", ame)
+	if err = setupArm(); err != nil {
+		log.Fatal("Can't set up robotic arm:", err)
+	}
+
+	geometry := odometry.Config{
+		WheelDiameter:      *wheelDiameter,
+		TicksPerRevolution: *ticksPerRevolution,
+		TrackWidth:         *trackWidth,
+	}
+	if odo, err = odometry.NewOdometry(motors, geometry); err != nil {
+		log.Fatal("Can't set up odometry:", err)
+	}
+	go odo.Run(context.Background(), odometry.DefaultInterval)
+	mover = motion.NewController(motors, geometry)
+	if obstacles != nil {
+		mover.Guard = obstacles
+	}
+	poller = telemetry.NewPoller(board, batteries, motors)
+	go poller.Run(context.Background())
+	setupPowerPolicy()
+	go powerPolicy.Run(context.Background(), power.DefaultInterval)
+	boardHealth = supervisor.NewSupervisor(board, resetBoard)
+	go boardHealth.Run(context.Background(), supervisor.DefaultInterval)
+
+	backend, err := newAuthBackend(false)
+	if err != nil {
+		log.Fatal("Can't initialize auth backend:", err)
 	}
+	am = auth.NewManager(backend)
 
 	if err := startForwarding(); err != nil {
 		log.Println("Failed to setup forwarding:", err)
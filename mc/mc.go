@@ -5,6 +5,9 @@ import "C"
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
 
 	"github.com/dasfoo/i2c"
 )
@@ -15,10 +18,33 @@ const Address = C.I2CAddress
 // MaxSpeed is a max speed (positive or negative) for motors
 const MaxSpeed = 90
 
+// ErrSpeedOutOfRange is returned when the motor speed is not in range -MaxSpeed .. MaxSpeed
+var ErrSpeedOutOfRange = errors.New("Motor speed is out of range")
+
+// CheckSpeed returns ErrSpeedOutOfRange if speed is not in range -MaxSpeed .. MaxSpeed
+func CheckSpeed(speed int) error {
+	if speed < -MaxSpeed || speed > MaxSpeed {
+		return ErrSpeedOutOfRange
+	}
+	return nil
+}
+
 // MC is a control interface for Motor Controller part of the project
 type MC struct {
 	bus     i2c.Bus
 	address byte
+
+	mu             sync.Mutex
+	ramps          [sides]Ramp
+	target         [sides]int8
+	current        [sides]float64
+	ramping        bool
+	rampGeneration int
+	rampErr        error
+	steppedAt      time.Time
+	// Last commanded state, the controller boots awake with brake released
+	asleep bool
+	brake  bool
 }
 
 // NewMC creates a new instance of BotBoarduino to use
@@ -51,14 +77,48 @@ const (
 	commandWake         = C.CommandWake
 )
 
+// command sends the command to the controller and remembers the state it sets
+func (mc *MC) command(command byte) error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if err := mc.bus.WriteByteToReg(mc.address, registerCommand, command); err != nil {
+		return err
+	}
+	switch command {
+	case commandSleep:
+		mc.asleep = true
+	case commandWake:
+		mc.asleep = false
+	case commandBrake:
+		mc.brake = true
+	case commandReleaseBrake:
+		mc.brake = false
+	}
+	return nil
+}
+
 // Sleep reduces power usage of the module (and some hardware)
 func (mc *MC) Sleep() error {
-	return mc.bus.WriteByteToReg(mc.address, registerCommand, commandSleep)
+	return mc.command(commandSleep)
 }
 
 // Wake is necessary to re-enable hardware disabled by Sleep()
 func (mc *MC) Wake() error {
-	return mc.bus.WriteByteToReg(mc.address, registerCommand, commandWake)
+	return mc.command(commandWake)
+}
+
+// Awake returns false if the controller has been put to Sleep
+func (mc *MC) Awake() bool {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return !mc.asleep
+}
+
+// Braking returns true if Brake has been enabled
+func (mc *MC) Braking() bool {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return mc.brake
 }
 
 // Brake enables or disables an algorithm which tries to keep motor encoder deltas to zero.
@@ -70,17 +130,17 @@ func (mc *MC) Brake(brake bool) error {
 	if !brake {
 		command = commandReleaseBrake
 	}
-	return mc.bus.WriteByteToReg(mc.address, registerCommand, command)
+	return mc.command(command)
 }
 
-// Right motor start, speed in rage -MaxSpeed .. MaxSpeed
+// Right motor start, speed in rage -MaxSpeed .. MaxSpeed, subject to SetRamp limits
 func (mc *MC) Right(speed int8) error {
-	return mc.bus.WriteByteToReg(mc.address, registerMotorRight, byte(int(speed)+MaxSpeed))
+	return mc.setSpeed(sideRight, speed)
 }
 
-// Left motor start, speed in rage -MaxSpeed .. MaxSpeed
+// Left motor start, speed in rage -MaxSpeed .. MaxSpeed, subject to SetRamp limits
 func (mc *MC) Left(speed int8) error {
-	return mc.bus.WriteByteToReg(mc.address, registerMotorLeft, byte(int(speed)+MaxSpeed))
+	return mc.setSpeed(sideLeft, speed)
 }
 
 // ReadEncoder reads encoder value, in absolute steps, Encoder{Left,Right}{Front,Back}
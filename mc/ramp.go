@@ -0,0 +1,171 @@
+package mc
+
+import (
+	"log"
+	"math"
+	"time"
+
+	"github.com/dasfoo/i2c"
+)
+
+// RampInterval is how often motor speeds are updated while ramping
+const RampInterval = 20 * time.Millisecond
+
+// Ramp limits how fast the motor speed can change, in speed units per second.
+// Zero value of a limit means the speed changes instantly.
+type Ramp struct {
+	// Acceleration applies when absolute speed increases
+	Acceleration float64
+	// Deceleration applies when absolute speed decreases (including reversing through zero)
+	Deceleration float64
+}
+
+const (
+	sideLeft = iota
+	sideRight
+	sides
+)
+
+var sideRegisters = [sides]byte{registerMotorLeft, registerMotorRight}
+
+// moveTowards returns value changed towards target by no more than delta (unless delta is 0)
+func moveTowards(value, target, delta float64) float64 {
+	if delta == 0 || math.Abs(target-value) <= delta {
+		return target
+	}
+	if target > value {
+		return value + delta
+	}
+	return value - delta
+}
+
+// next returns the speed after dt seconds of moving from current towards target
+func (r Ramp) next(current, target, dt float64) float64 {
+	if current != 0 && (current*target < 0 || math.Abs(target) < math.Abs(current)) {
+		stop := target
+		if current*target < 0 {
+			if r.Deceleration == 0 {
+				// Stop instantly, and accelerate in the other direction right away
+				return moveTowards(0, target, r.Acceleration*dt)
+			}
+			// Reversing: slow down to zero first, accelerate on the next steps
+			stop = 0
+		}
+		return moveTowards(current, stop, r.Deceleration*dt)
+	}
+	return moveTowards(current, target, r.Acceleration*dt)
+}
+
+// SetRamp configures acceleration limits for left and right motors
+func (mc *MC) SetRamp(left, right Ramp) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.ramps = [sides]Ramp{left, right}
+}
+
+func (mc *MC) writeSpeed(side int, speed float64) error {
+	return mc.writeSpeedTo(mc.bus, side, speed)
+}
+
+func (mc *MC) writeSpeedTo(bus i2c.Bus, side int, speed float64) error {
+	mc.current[side] = speed
+	return bus.WriteByteToReg(mc.address, sideRegisters[side], byte(int(speed)+MaxSpeed))
+}
+
+// step moves both motors towards their targets, and reports whether the targets are reached
+func (mc *MC) step() (bool, error) {
+	now := time.Now()
+	dt := math.Min(now.Sub(mc.steppedAt).Seconds(), RampInterval.Seconds())
+	mc.steppedAt = now
+	var err error
+	reached := true
+	for side := 0; side < sides; side++ {
+		target := float64(mc.target[side])
+		speed := mc.ramps[side].next(mc.current[side], target, dt)
+		// Keep the fraction, so that slow ramps make progress over multiple steps
+		if math.Trunc(speed) == math.Trunc(mc.current[side]) {
+			mc.current[side] = speed
+		} else if e := mc.writeSpeed(side, speed); e != nil && err == nil {
+			err = e
+		}
+		reached = reached && mc.current[side] == target
+	}
+	return reached, err
+}
+
+// ramp runs in background until both motors reach their target speeds,
+// or another ramp generation is started
+func (mc *MC) ramp(generation int) {
+	ticker := time.NewTicker(RampInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		mc.mu.Lock()
+		if generation != mc.rampGeneration {
+			mc.mu.Unlock()
+			return
+		}
+		reached, err := mc.step()
+		if err != nil {
+			log.Println("Failed to ramp motor speed:", err)
+			mc.rampErr = err
+		}
+		if reached {
+			mc.ramping = false
+			mc.mu.Unlock()
+			return
+		}
+		mc.mu.Unlock()
+	}
+}
+
+// setSpeed changes the target speed of the side and starts ramping towards it
+func (mc *MC) setSpeed(side int, speed int8) error {
+	if err := CheckSpeed(int(speed)); err != nil {
+		return err
+	}
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.target[side] = speed
+	if !mc.ramping {
+		mc.steppedAt = time.Now().Add(-RampInterval)
+	}
+	reached, err := mc.step()
+	if err == nil {
+		// Report an error that has happened while ramping in background
+		err, mc.rampErr = mc.rampErr, nil
+	}
+	if !reached && !mc.ramping {
+		mc.ramping = true
+		mc.rampGeneration++
+		go mc.ramp(mc.rampGeneration)
+	}
+	return err
+}
+
+// urgentBus is implemented by buses which can prioritize transactions, e.g. arbiter.Arbiter
+type urgentBus interface {
+	Urgent() i2c.Bus
+}
+
+// Stop immediately stops both motors, ignoring the acceleration limits.
+// If the bus supports it, stop commands go before other transactions waiting for the bus.
+func (mc *MC) Stop() error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.ramping = false
+	mc.rampGeneration++
+	mc.target = [sides]int8{}
+	mc.rampErr = nil
+	bus := mc.bus
+	if u, ok := bus.(urgentBus); ok {
+		bus = u.Urgent()
+	}
+	var err error
+	for side := 0; side < sides; side++ {
+		// Try to stop all motors, even if some have failed
+		if e := mc.writeSpeedTo(bus, side, 0); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
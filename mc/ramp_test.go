@@ -0,0 +1,215 @@
+package mc
+
+import (
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dasfoo/i2c"
+)
+
+// recordingBus remembers motor speeds written to it; other transactions are not expected
+type recordingBus struct {
+	i2c.Bus
+	mu     sync.Mutex
+	speeds map[byte][]int
+}
+
+func newRecordingBus() *recordingBus {
+	return &recordingBus{speeds: make(map[byte][]int)}
+}
+
+func (b *recordingBus) WriteByteToReg(addr, reg, value byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.speeds[reg] = append(b.speeds[reg], int(value)-MaxSpeed)
+	return nil
+}
+
+func (b *recordingBus) written(reg byte) []int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]int(nil), b.speeds[reg]...)
+}
+
+// urgentRecordingBus records urgent transactions separately, like arbiter.Arbiter
+type urgentRecordingBus struct {
+	*recordingBus
+	urgent *recordingBus
+}
+
+func (b *urgentRecordingBus) Urgent() i2c.Bus {
+	return b.urgent
+}
+
+// waitFor polls the bus until the last speed written to reg is target
+func waitFor(t *testing.T, b *recordingBus, reg byte, target int) []int {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if speeds := b.written(reg); len(speeds) > 0 && speeds[len(speeds)-1] == target {
+			// Make sure the ramp has finished and nothing else is written
+			time.Sleep(3 * RampInterval)
+			return b.written(reg)
+		}
+		time.Sleep(RampInterval)
+	}
+	t.Fatalf("Speed %d not reached on register 0x%.2x, written: %v", target, reg,
+		b.written(reg))
+	return nil
+}
+
+// checkSteps fails unless consecutive speeds differ by no more than limit units per second
+func checkSteps(t *testing.T, speeds []int, limit float64) {
+	// The step is computed for at most RampInterval, and truncated to integer speed
+	maxStep := int(math.Ceil(limit*RampInterval.Seconds())) + 1
+	for i := 1; i < len(speeds); i++ {
+		if step := speeds[i] - speeds[i-1]; step > maxStep || step < -maxStep {
+			t.Errorf("Speed changed from %d to %d, limit is %d per step: %v",
+				speeds[i-1], speeds[i], maxStep, speeds)
+		}
+	}
+}
+
+func TestRampNext(t *testing.T) {
+	r := Ramp{Acceleration: 100, Deceleration: 200}
+	for _, test := range []struct {
+		current, target, want float64
+	}{
+		{0, 90, 10},
+		{0, -90, -10},
+		{85, 90, 90},
+		{50, 10, 30},
+		{-50, -10, -30},
+		{15, 0, 0},
+		// Reversing: decelerate to zero, never past it in one step
+		{50, -50, 30},
+		{10, -50, 0},
+		{-10, 50, 0},
+	} {
+		if got := r.next(test.current, test.target, 0.1); got != test.want {
+			t.Errorf("next(%v, %v) = %v, want %v", test.current, test.target, got, test.want)
+		}
+	}
+	if got := (Ramp{}).next(-90, 90, 0.1); got != 90 {
+		t.Errorf("Zero Ramp should change speed instantly, got %v", got)
+	}
+}
+
+func TestRampLimitsPerSide(t *testing.T) {
+	bus := newRecordingBus()
+	mc := NewMC(bus, Address)
+	mc.SetRamp(Ramp{Acceleration: 1000, Deceleration: 2000}, Ramp{Acceleration: 300})
+	if err := mc.Left(90); err != nil {
+		t.Fatal(err)
+	}
+	if err := mc.Right(90); err != nil {
+		t.Fatal(err)
+	}
+	right := waitFor(t, bus, registerMotorRight, 90)
+	left := waitFor(t, bus, registerMotorLeft, 90)
+	checkSteps(t, left, 1000)
+	checkSteps(t, right, 300)
+	if len(left) >= len(right) {
+		t.Errorf("Left side with higher acceleration took more steps than the right: %v, %v",
+			left, right)
+	}
+
+	if err := mc.Left(0); err != nil {
+		t.Fatal(err)
+	}
+	left = waitFor(t, bus, registerMotorLeft, 0)
+	checkSteps(t, left, 2000)
+}
+
+func TestRampReverse(t *testing.T) {
+	bus := newRecordingBus()
+	mc := NewMC(bus, Address)
+	if err := mc.Left(60); err != nil {
+		t.Fatal(err)
+	}
+	mc.SetRamp(Ramp{Acceleration: 500, Deceleration: 1000}, Ramp{})
+	if err := mc.Left(-60); err != nil {
+		t.Fatal(err)
+	}
+	speeds := waitFor(t, bus, registerMotorLeft, -60)
+	if speeds[0] != 60 {
+		t.Fatalf("Instant start to 60 expected without a ramp, got %v", speeds)
+	}
+	checkSteps(t, speeds, 1000)
+	crossed := false
+	for i := 1; i < len(speeds); i++ {
+		if speeds[i] > speeds[i-1] {
+			t.Fatalf("Speed should only go down when reversing: %v", speeds)
+		}
+		if speeds[i] == 0 {
+			crossed = true
+		}
+		if speeds[i] < 0 {
+			// Past zero, acceleration limit applies
+			checkSteps(t, speeds[i-1:], 500)
+		}
+	}
+	if !crossed {
+		t.Errorf("Reversing should stop at zero first: %v", speeds)
+	}
+}
+
+func TestRampNewSetpoint(t *testing.T) {
+	bus := newRecordingBus()
+	mc := NewMC(bus, Address)
+	mc.SetRamp(Ramp{Acceleration: 200, Deceleration: 200}, Ramp{})
+	if err := mc.Left(90); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * RampInterval)
+	before := bus.written(registerMotorLeft)
+	if err := mc.Left(-20); err != nil {
+		t.Fatal(err)
+	}
+	speeds := waitFor(t, bus, registerMotorLeft, -20)
+	peak := before[len(before)-1]
+	if peak <= 0 || peak >= 90 {
+		t.Fatalf("The first ramp should be in progress, got %v", before)
+	}
+	// Only the new ramp may write after the setpoint change
+	for i := len(before); i < len(speeds); i++ {
+		if speeds[i] > speeds[i-1] {
+			t.Fatalf("The old ramp kept running after the new setpoint: %v", speeds)
+		}
+	}
+	checkSteps(t, speeds, 200)
+}
+
+func TestStopSkipsRamp(t *testing.T) {
+	bus := &urgentRecordingBus{
+		recordingBus: newRecordingBus(),
+		urgent:       newRecordingBus(),
+	}
+	mc := NewMC(bus, Address)
+	mc.SetRamp(Ramp{Acceleration: 100, Deceleration: 100},
+		Ramp{Acceleration: 100, Deceleration: 100})
+	if err := mc.Left(90); err != nil {
+		t.Fatal(err)
+	}
+	if err := mc.Right(-90); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * RampInterval)
+	if err := mc.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	left := bus.written(registerMotorLeft)
+	right := bus.written(registerMotorRight)
+	for _, reg := range []byte{registerMotorLeft, registerMotorRight} {
+		if speeds := bus.urgent.written(reg); len(speeds) != 1 || speeds[0] != 0 {
+			t.Errorf("Stop should write zero speed to urgent bus, got %v", speeds)
+		}
+	}
+	time.Sleep(5 * RampInterval)
+	if len(bus.written(registerMotorLeft)) != len(left) ||
+		len(bus.written(registerMotorRight)) != len(right) {
+		t.Errorf("The ramp kept running after Stop: %v, %v",
+			bus.written(registerMotorLeft), bus.written(registerMotorRight))
+	}
+}
@@ -0,0 +1,92 @@
+package mc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SimulatorStepsPerSecond is the encoder rate of a simulated wheel rotating at MaxSpeed
+const SimulatorStepsPerSecond = 2000
+
+// Simulator emulates Motor Controller firmware registers, to be attached to sim.Bus
+type Simulator struct {
+	mu        sync.Mutex
+	awake     bool
+	brake     bool
+	left      byte
+	right     byte
+	encoders  [4]float64
+	updatedAt time.Time
+}
+
+// NewSimulator creates a simulated Motor Controller with motors stopped
+func NewSimulator() *Simulator {
+	return &Simulator{
+		awake:     true,
+		left:      MaxSpeed,
+		right:     MaxSpeed,
+		updatedAt: time.Now(),
+	}
+}
+
+// update advances encoders according to the motor speeds since the last update
+func (s *Simulator) update() {
+	now := time.Now()
+	elapsed := now.Sub(s.updatedAt).Seconds()
+	s.updatedAt = now
+	if !s.awake {
+		return
+	}
+	left := float64(int(s.left)-MaxSpeed) / MaxSpeed * SimulatorStepsPerSecond * elapsed
+	right := float64(int(s.right)-MaxSpeed) / MaxSpeed * SimulatorStepsPerSecond * elapsed
+	s.encoders[EncoderLeftFront-EncoderLeftFront] += left
+	s.encoders[EncoderLeftBack-EncoderLeftFront] += left
+	s.encoders[EncoderRightFront-EncoderLeftFront] += right
+	s.encoders[EncoderRightBack-EncoderLeftFront] += right
+}
+
+// Write handles a write transaction to the controller
+func (s *Simulator) Write(reg byte, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.update()
+	value := data[0]
+	switch reg {
+	case registerCommand:
+		switch value {
+		case commandBrake:
+			s.brake = true
+		case commandReleaseBrake:
+			s.brake = false
+		case commandSleep:
+			s.awake = false
+		case commandWake:
+			s.awake = true
+		}
+	case registerMotorLeft:
+		s.left = value
+	case registerMotorRight:
+		s.right = value
+	}
+	return nil
+}
+
+// Read handles a read transaction from the controller
+func (s *Simulator) Read(reg byte, data []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.update()
+	encoder := int(reg) - EncoderLeftFront
+	if encoder < 0 || encoder >= len(s.encoders) {
+		return 0, fmt.Errorf("Register 0x%.2x is not readable", reg)
+	}
+	value := make([]byte, 4)
+	// Wrap around like int32 counters in the firmware
+	binary.LittleEndian.PutUint32(value, uint32(int64(s.encoders[encoder])))
+	return copy(data, value), nil
+}
@@ -0,0 +1,227 @@
+package motion
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/dasfoo/rover/guard"
+	"github.com/dasfoo/rover/mc"
+	"github.com/dasfoo/rover/odometry"
+)
+
+// Tuning of the closed-loop movement
+const (
+	// Interval between encoder readings and motor speed corrections
+	Interval = 20 * time.Millisecond
+	// Tolerance is how close to the target (meters of wheel travel) is good enough
+	Tolerance = 0.005
+	// MinSpeed is the slowest speed at which the rover still moves
+	MinSpeed = 15
+	// approachGain slows the rover down near the target, speed units per meter left
+	approachGain = 300
+	// stallTimeout is how long the wheels may stay still before giving up
+	stallTimeout = 2 * time.Second
+)
+
+// Error definitions
+var (
+	ErrStalled       = errors.New("The wheels are not moving, giving up")
+	ErrInvalidSpeed  = errors.New("Speed must be in range 1..MaxSpeed")
+	ErrInvalidTarget = errors.New("Target must be non-zero")
+	ErrBlocked       = errors.New("An obstacle is in the way, giving up")
+)
+
+// DefaultSync are the gains for keeping left and right sides at the same pace,
+// speed units per meter of difference.
+var DefaultSync = PID{Kp: 200, Ki: 50}
+
+// Motors is the subset of mc.MC used for closed-loop movement
+type Motors interface {
+	odometry.EncoderReader
+	Left(speed int8) error
+	Right(speed int8) error
+	Stop() error
+}
+
+// Limiter reduces motor speeds, e.g. guard.Guard near obstacles
+type Limiter interface {
+	Limit(ctx context.Context, left, right int8) (int8, int8, guard.Limit)
+}
+
+// Controller moves the rover for the specified distance or angle using encoder feedback
+type Controller struct {
+	motors Motors
+	config odometry.Config
+	// Sync synchronizes left and right sides
+	Sync PID
+	// Guard is optional, checked on every Interval when driving forward
+	Guard Limiter
+
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	running sync.Mutex
+}
+
+// NewController creates a Controller for the rover of given geometry
+func NewController(motors Motors, config odometry.Config) *Controller {
+	return &Controller{
+		motors: motors,
+		config: config,
+		Sync:   DefaultSync,
+	}
+}
+
+// Stop aborts the movement in progress, if any, and waits until it has stopped the motors,
+// so that they can be driven by someone else
+func (c *Controller) Stop() {
+	c.mu.Lock()
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.mu.Unlock()
+	c.running.Lock()
+	c.running.Unlock()
+}
+
+// DriveDistance moves the rover straight for meters (negative to go backwards) with speed
+// in range 1..mc.MaxSpeed, and returns the distance actually travelled.
+func (c *Controller) DriveDistance(ctx context.Context, meters float64,
+	speed int8) (float64, error) {
+	direction := 1.0
+	if meters < 0 {
+		direction = -1
+	}
+	left, right, err := c.move(ctx, math.Abs(meters), speed, direction, direction)
+	return (left + right) / 2, err
+}
+
+// Rotate turns the rover in place for degrees (positive is counter-clockwise) with speed
+// in range 1..mc.MaxSpeed, and returns the angle actually turned.
+func (c *Controller) Rotate(ctx context.Context, degrees float64,
+	speed int8) (float64, error) {
+	direction := 1.0
+	if degrees < 0 {
+		direction = -1
+	}
+	travel := math.Abs(degrees) * math.Pi / 180 * c.config.TrackWidth / 2
+	left, right, err := c.move(ctx, travel, speed, -direction, direction)
+	return (right - left) / c.config.TrackWidth * 180 / math.Pi, err
+}
+
+// begin cancels the movement in progress and waits for it to finish
+func (c *Controller) begin(ctx context.Context) (context.Context, func()) {
+	c.mu.Lock()
+	if c.cancel != nil {
+		c.cancel()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	c.cancel = cancel
+	c.mu.Unlock()
+
+	c.running.Lock()
+	return ctx, func() {
+		cancel()
+		c.running.Unlock()
+	}
+}
+
+func clampSpeed(speed float64) int8 {
+	return int8(math.Max(-mc.MaxSpeed, math.Min(mc.MaxSpeed, math.Trunc(speed))))
+}
+
+// move makes each wheel travel the distance in the direction given by its sign (+1 or -1),
+// returning the distance travelled by left and right wheels.
+func (c *Controller) move(ctx context.Context, distance float64, speed int8,
+	leftSign, rightSign float64) (left, right float64, err error) {
+	if speed <= 0 || speed > mc.MaxSpeed {
+		return 0, 0, ErrInvalidSpeed
+	}
+	if distance == 0 {
+		return 0, 0, ErrInvalidTarget
+	}
+	ctx, end := c.begin(ctx)
+	defer end()
+
+	odo, err := odometry.NewOdometry(c.motors, c.config)
+	if err != nil {
+		return
+	}
+	if err = odo.Update(); err != nil {
+		return
+	}
+	defer func() {
+		// The rover is slow near the target, so it can stop instantly
+		stopErr := c.motors.Stop()
+		// Let the rover settle down and count the last steps
+		time.Sleep(Interval)
+		if e := odo.Update(); stopErr == nil {
+			stopErr = e
+		}
+		left, right = odo.Wheels()
+		if err == nil {
+			err = stopErr
+		}
+	}()
+
+	pid := c.Sync
+	pid.Reset()
+	ticker := time.NewTicker(Interval)
+	defer ticker.Stop()
+	var (
+		progress    float64
+		progressed  = time.Now()
+		previous    = time.Now()
+		targetSpeed = float64(speed)
+	)
+	for {
+		if err = odo.Update(); err != nil {
+			return
+		}
+		left, right = odo.Wheels()
+		// Normalize travel so that both values grow towards the target
+		left, right = left*leftSign, right*rightSign
+		current := (left + right) / 2
+		if distance-current <= Tolerance {
+			return
+		}
+
+		now := time.Now()
+		if current > progress {
+			progress, progressed = current, now
+		} else if now.Sub(progressed) > stallTimeout {
+			err = ErrStalled
+			return
+		}
+		base := math.Max(MinSpeed, math.Min(targetSpeed, (distance-current)*approachGain))
+		correction := pid.Update(left-right, now.Sub(previous).Seconds())
+		previous = now
+
+		leftSpeed := clampSpeed(leftSign * (base - correction))
+		rightSpeed := clampSpeed(rightSign * (base + correction))
+		if c.Guard != nil && leftSign > 0 && rightSign > 0 {
+			var limit guard.Limit
+			leftSpeed, rightSpeed, limit = c.Guard.Limit(ctx, leftSpeed, rightSpeed)
+			if limit.Limited && int(leftSpeed)+int(rightSpeed) <= 0 {
+				err = ErrBlocked
+				return
+			}
+		}
+		if err = c.motors.Left(leftSpeed); err != nil {
+			return
+		}
+		if err = c.motors.Right(rightSpeed); err != nil {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package motion
+
+// PID is a proportional-integral-derivative controller
+type PID struct {
+	Kp, Ki, Kd float64
+
+	integral float64
+	previous float64
+	started  bool
+}
+
+// Update returns the control value for the error measured dt seconds after the previous one
+func (p *PID) Update(err, dt float64) float64 {
+	var derivative float64
+	if p.started && dt > 0 {
+		p.integral += err * dt
+		derivative = (err - p.previous) / dt
+	}
+	p.previous, p.started = err, true
+	return p.Kp*err + p.Ki*p.integral + p.Kd*derivative
+}
+
+// Reset clears the accumulated state, keeping the gains
+func (p *PID) Reset() {
+	p.integral, p.previous, p.started = 0, 0, false
+}
@@ -0,0 +1,202 @@
+package odometry
+
+import (
+	"errors"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/dasfoo/rover/mc"
+)
+
+// DefaultInterval is a recommended encoders polling interval for Run
+const DefaultInterval = 50 * time.Millisecond
+
+// maxDisagreement is the max relative difference between front and back wheel encoders
+// on the same side, after which one of them is considered to be slipping or faulty.
+const maxDisagreement = 0.25
+
+// Config describes the rover geometry
+type Config struct {
+	// WheelDiameter in meters
+	WheelDiameter float64
+	// TicksPerRevolution is the number of encoder steps per one full wheel revolution
+	TicksPerRevolution float64
+	// TrackWidth is the distance between left and right wheels, in meters
+	TrackWidth float64
+}
+
+// ErrInvalidConfig is returned for the rover geometry with non-positive values
+var ErrInvalidConfig = errors.New("Wheel diameter, ticks per revolution and track width " +
+	"must be positive")
+
+// Validate returns ErrInvalidConfig unless all the values are positive
+func (c Config) Validate() error {
+	if !(c.WheelDiameter > 0 && c.TicksPerRevolution > 0 && c.TrackWidth > 0) {
+		return ErrInvalidConfig
+	}
+	return nil
+}
+
+// DefaultConfig matches the rover chassis
+var DefaultConfig = Config{
+	WheelDiameter:      0.12,
+	TicksPerRevolution: 1000,
+	TrackWidth:         0.25,
+}
+
+// Pose is the rover position (meters) and heading (radians, counter-clockwise,
+// in range -Pi..Pi) relative to where the odometry has been started or reset.
+type Pose struct {
+	X, Y, Theta float64
+}
+
+// EncoderReader reads absolute encoder values, e.g. mc.MC
+type EncoderReader interface {
+	ReadEncoder(encoder byte) (int32, error)
+}
+
+var encoders = [...]byte{
+	mc.EncoderLeftFront,
+	mc.EncoderLeftBack,
+	mc.EncoderRightFront,
+	mc.EncoderRightBack,
+}
+
+// Odometry estimates the rover pose from wheel encoders
+type Odometry struct {
+	config  Config
+	reader  EncoderReader
+	mu      sync.Mutex
+	pose    Pose
+	left    float64
+	right   float64
+	last    [len(encoders)]int32
+	started bool
+}
+
+// NewOdometry creates an Odometry with pose at the origin
+func NewOdometry(reader EncoderReader, config Config) (*Odometry, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &Odometry{
+		config: config,
+		reader: reader,
+	}, nil
+}
+
+// Run polls the encoders with the interval until ctx is done
+func (o *Odometry) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var lastErr error
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := o.Update()
+			// Only log changes, to avoid flooding the log at the polling rate
+			if err != nil && lastErr == nil {
+				log.Println("Odometry update failed:", err)
+			} else if err == nil && lastErr != nil {
+				log.Println("Odometry has recovered")
+			}
+			lastErr = err
+		}
+	}
+}
+
+// sideTicks combines front and back encoder deltas of one side into a single value
+func sideTicks(front, back int32) float64 {
+	f, b := float64(front), float64(back)
+	switch {
+	case f == b:
+		return f
+	case f == 0 || b == 0:
+		// One of the encoders is likely disconnected
+		return f + b
+	case math.Abs(f-b) <= maxDisagreement*math.Max(math.Abs(f), math.Abs(b)):
+		return (f + b) / 2
+	case math.Abs(f) < math.Abs(b):
+		// The wheel with more steps is slipping (or the encoder glitched)
+		return f
+	}
+	return b
+}
+
+// Update reads encoders once and integrates the movement since the previous Update
+func (o *Odometry) Update() error {
+	var values [len(encoders)]int32
+	for i, encoder := range encoders {
+		var err error
+		if values[i], err = o.reader.ReadEncoder(encoder); err != nil {
+			return err
+		}
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.started {
+		o.last, o.started = values, true
+		return nil
+	}
+	var deltas [len(encoders)]int32
+	for i := range values {
+		// int32 subtraction takes care of the counters wrapping around
+		deltas[i] = values[i] - o.last[i]
+	}
+	o.last = values
+
+	metersPerTick := math.Pi * o.config.WheelDiameter / o.config.TicksPerRevolution
+	left := sideTicks(deltas[0], deltas[1]) * metersPerTick
+	right := sideTicks(deltas[2], deltas[3]) * metersPerTick
+
+	o.left += left
+	o.right += right
+
+	distance := (left + right) / 2
+	rotation := (right - left) / o.config.TrackWidth
+	heading := o.pose.Theta + rotation/2
+	o.pose.X += distance * math.Cos(heading)
+	o.pose.Y += distance * math.Sin(heading)
+	o.pose.Theta = NormalizeAngle(o.pose.Theta + rotation)
+	return nil
+}
+
+// NormalizeAngle brings angle in radians to range -Pi..Pi
+func NormalizeAngle(angle float64) float64 {
+	angle = math.Mod(angle, 2*math.Pi)
+	if angle > math.Pi {
+		angle -= 2 * math.Pi
+	} else if angle < -math.Pi {
+		angle += 2 * math.Pi
+	}
+	return angle
+}
+
+// Pose returns the current pose estimate
+func (o *Odometry) Pose() Pose {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.pose
+}
+
+// Wheels returns the total distance travelled by left and right wheels, in meters.
+// Moving backwards decreases the distance; Reset does not affect it.
+func (o *Odometry) Wheels() (left, right float64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.left, o.right
+}
+
+// Reset moves the origin to the current rover pose
+func (o *Odometry) Reset() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.pose = Pose{}
+}
@@ -0,0 +1,148 @@
+package odometry
+
+import (
+	"math"
+	"testing"
+
+	"github.com/dasfoo/rover/mc"
+)
+
+// fakeEncoders returns encoder values set by the test
+type fakeEncoders map[byte]int32
+
+func (f fakeEncoders) ReadEncoder(encoder byte) (int32, error) {
+	return f[encoder], nil
+}
+
+// add moves the left and right encoders by the number of ticks
+func (f fakeEncoders) add(left, right int32) {
+	f[mc.EncoderLeftFront] += left
+	f[mc.EncoderLeftBack] += left
+	f[mc.EncoderRightFront] += right
+	f[mc.EncoderRightBack] += right
+}
+
+func TestSideTicks(t *testing.T) {
+	for _, test := range []struct {
+		front, back int32
+		want        float64
+	}{
+		{100, 100, 100},
+		{-50, -50, -50},
+		{100, 0, 100},
+		{0, -80, -80},
+		{100, 90, 95},
+		{-100, -80, -90},
+		// Too far apart: the lower count is trusted, the other wheel is slipping
+		{100, 50, 50},
+		{20, 100, 20},
+		{-100, -10, -10},
+	} {
+		if got := sideTicks(test.front, test.back); got != test.want {
+			t.Errorf("sideTicks(%d, %d) = %v, want %v", test.front, test.back, got, test.want)
+		}
+	}
+}
+
+func newTestOdometry(t *testing.T, encoders fakeEncoders) *Odometry {
+	// One tick per centimeter
+	o, err := NewOdometry(encoders, Config{
+		WheelDiameter:      1 / math.Pi,
+		TicksPerRevolution: 100,
+		TrackWidth:         2 / math.Pi,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = o.Update(); err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestUpdate(t *testing.T) {
+	encoders := fakeEncoders{}
+	o := newTestOdometry(t, encoders)
+
+	encoders.add(100, 100)
+	if err := o.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if pose := o.Pose(); !near(pose.X, 1) || !near(pose.Y, 0) || !near(pose.Theta, 0) {
+		t.Errorf("Pose after 1m straight = %+v", pose)
+	}
+
+	// Turn in place by 90 degrees counter-clockwise: each wheel travels a quarter of
+	// the circle of TrackWidth diameter, which is 50cm
+	encoders.add(-50, 50)
+	if err := o.Update(); err != nil {
+		t.Fatal(err)
+	}
+	encoders.add(100, 100)
+	if err := o.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if pose := o.Pose(); !near(pose.X, 1) || !near(pose.Y, 1) || !near(pose.Theta, math.Pi/2) {
+		t.Errorf("Pose after turning left and 1m straight = %+v", pose)
+	}
+	if left, right := o.Wheels(); !near(left, 1.5) || !near(right, 2.5) {
+		t.Errorf("Wheels() = %v, %v", left, right)
+	}
+
+	o.Reset()
+	if pose := o.Pose(); pose != (Pose{}) {
+		t.Errorf("Pose after Reset = %+v", pose)
+	}
+	if left, _ := o.Wheels(); left == 0 {
+		t.Error("Reset must not affect Wheels")
+	}
+}
+
+func TestUpdateWrapAround(t *testing.T) {
+	encoders := fakeEncoders{}
+	encoders.add(math.MaxInt32-10, math.MinInt32+10)
+	o := newTestOdometry(t, encoders)
+	// Left counter overflows forwards, right one backwards
+	encoders[mc.EncoderLeftFront] += 20
+	encoders[mc.EncoderLeftBack] += 20
+	encoders[mc.EncoderRightFront] -= 20
+	encoders[mc.EncoderRightBack] -= 20
+	if err := o.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if left, right := o.Wheels(); !near(left, 0.2) || !near(right, -0.2) {
+		t.Errorf("Wheels() after wrap around = %v, %v, want 0.2, -0.2", left, right)
+	}
+}
+
+func TestNormalizeAngle(t *testing.T) {
+	for _, test := range []struct {
+		angle, want float64
+	}{
+		{0, 0},
+		{math.Pi / 2, math.Pi / 2},
+		{3 * math.Pi / 2, -math.Pi / 2},
+		{-3 * math.Pi / 2, math.Pi / 2},
+		{5 * math.Pi, math.Pi},
+	} {
+		if got := NormalizeAngle(test.angle); !near(got, test.want) {
+			t.Errorf("NormalizeAngle(%v) = %v, want %v", test.angle, got, test.want)
+		}
+	}
+}
+
+func TestNewOdometryValidates(t *testing.T) {
+	for _, config := range []Config{
+		{},
+		{WheelDiameter: 0.1, TicksPerRevolution: 100},
+		{WheelDiameter: -0.1, TicksPerRevolution: 100, TrackWidth: 0.2},
+	} {
+		if _, err := NewOdometry(fakeEncoders{}, config); err != ErrInvalidConfig {
+			t.Errorf("NewOdometry(%+v) = %v, want ErrInvalidConfig", config, err)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package power
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/dasfoo/rover/battery"
+)
+
+// State of the power supply; every next state is more severe
+type State int
+
+// Power states, from the normal operation to the shutdown
+const (
+	Normal State = iota
+	Low
+	Critical
+	Shutdown
+)
+
+func (s State) String() string {
+	switch s {
+	case Normal:
+		return "normal"
+	case Low:
+		return "low"
+	case Critical:
+		return "critical"
+	case Shutdown:
+		return "shutdown"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// DefaultInterval between battery checks
+const DefaultInterval = 10 * time.Second
+
+// Config contains battery percentage thresholds below which the state is entered
+type Config struct {
+	Low      float64
+	Critical float64
+	Shutdown float64
+	// Hysteresis is how much higher the percentage has to be to leave the state,
+	// so that the state doesn't flap on a noisy reading
+	Hysteresis float64
+}
+
+// DefaultConfig is suitable for LiPo batteries, which must not be discharged too deep
+var DefaultConfig = Config{
+	Low:        25,
+	Critical:   10,
+	Shutdown:   5,
+	Hysteresis: 5,
+}
+
+// Reader reads the battery, e.g. battery.Monitor
+type Reader interface {
+	Read() (battery.Reading, error)
+}
+
+// Action is run when the state is entered (and possibly left)
+type Action struct {
+	Name string
+	// Enter is run when the state becomes at least as severe as the one of the action
+	Enter func() error
+	// Leave is optional, run when the state becomes less severe than the one of the action
+	Leave func() error
+}
+
+// Policy watches the battery and runs actions when the power state changes
+type Policy struct {
+	reader Reader
+	config Config
+
+	// checking serializes Check, so that actions of one transition don't interleave with
+	// another; mu is not held while the actions run, as they can take a while
+	checking sync.Mutex
+	mu       sync.Mutex
+	actions  map[State][]Action
+	state    State
+	reading  battery.Reading
+	err      error
+}
+
+// NewPolicy creates a Policy for the battery read by reader
+func NewPolicy(reader Reader, config Config) *Policy {
+	return &Policy{
+		reader:  reader,
+		config:  config,
+		actions: make(map[State][]Action),
+	}
+}
+
+// On adds the action for the state. Actions are run in the order they are added.
+func (p *Policy) On(state State, action Action) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.actions[state] = append(p.actions[state], action)
+}
+
+// Status returns the current state and the latest battery reading (or error)
+func (p *Policy) Status() (State, battery.Reading, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state, p.reading, p.err
+}
+
+func (p *Policy) threshold(state State) float64 {
+	switch state {
+	case Low:
+		return p.config.Low
+	case Critical:
+		return p.config.Critical
+	case Shutdown:
+		return p.config.Shutdown
+	}
+	return 100
+}
+
+// next returns the state for the percentage, given the current state
+func (p *Policy) next(percentage float64) State {
+	state := p.state
+	// Leave the states for which the percentage is well above the threshold
+	for state > Normal && percentage >= p.threshold(state)+p.config.Hysteresis {
+		state--
+	}
+	// Enter the states for which the percentage is below the threshold
+	for state < Shutdown && percentage < p.threshold(state+1) {
+		state++
+	}
+	return state
+}
+
+// step is an action to run on the state transition
+type step struct {
+	state  State
+	action Action
+	fn     func() error
+	verb   string
+}
+
+func (s step) run() {
+	if s.fn == nil {
+		return
+	}
+	log.Printf("Power state %s: %s %q", s.state, s.verb, s.action.Name)
+	if err := s.fn(); err != nil {
+		log.Printf("Power state %s: failed to %s %q: %s", s.state, s.verb, s.action.Name, err)
+	}
+}
+
+// Check reads the battery and runs the actions if the state has changed.
+// The state doesn't change when the battery can't be read.
+func (p *Policy) Check() {
+	p.checking.Lock()
+	defer p.checking.Unlock()
+	for _, s := range p.transition() {
+		s.run()
+	}
+}
+
+// transition reads the battery, updates the state and returns the actions to run
+func (p *Policy) transition() []step {
+	reading, err := p.reader.Read()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reading, p.err = reading, err
+	if err != nil {
+		return nil
+	}
+	next := p.next(reading.Percentage)
+	if next == p.state {
+		return nil
+	}
+	log.Printf("Battery at %.1f%% (%.2fV), power state %s -> %s",
+		reading.Percentage, reading.Voltage, p.state, next)
+	var steps []step
+	for p.state < next {
+		p.state++
+		for _, action := range p.actions[p.state] {
+			steps = append(steps, step{p.state, action, action.Enter, "enter"})
+		}
+	}
+	for p.state > next {
+		actions := p.actions[p.state]
+		for i := len(actions) - 1; i >= 0; i-- {
+			steps = append(steps, step{p.state, actions[i], actions[i].Leave, "leave"})
+		}
+		p.state--
+	}
+	return steps
+}
+
+// Run checks the battery every interval until ctx is done
+func (p *Policy) Run(ctx context.Context, interval time.Duration) {
+	p.Check()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.Check()
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package rpc
+
+import (
+	"strings"
+
+	"github.com/dasfoo/rover/auth"
+)
+
+// methodLevels is the access level required to call the RoverService method.
+// Methods not listed here require auth.Admin.
+var methodLevels = map[string]auth.Level{
+	// Exchanging the user token for a session token
+	"Login": auth.Viewer,
+
+	// Reading sensors and state
+	"GetBatteryPercentage":      auth.Viewer,
+	"GetAmbientLight":           auth.Viewer,
+	"GetTemperatureAndHumidity": auth.Viewer,
+	"ReadEncoders":              auth.Viewer,
+	"GetPose":                   auth.Viewer,
+	"GetArmPose":                auth.Viewer,
+	"ListArmLibrary":            auth.Viewer,
+	"SubscribeTelemetry":        auth.Viewer,
+	"GetBusStats":               auth.Viewer,
+	"GetBoardHealth":            auth.Viewer,
+	"GetPowerState":             auth.Viewer,
+	"GetControllerState":        auth.Viewer,
+
+	// Moving the rover and its parts
+	"MoveRover":       auth.Operator,
+	"Drive":           auth.Operator,
+	"DriveDistance":   auth.Operator,
+	"Rotate":          auth.Operator,
+	"ResetPose":       auth.Operator,
+	"MoveArm":         auth.Operator,
+	"MoveArmTo":       auth.Operator,
+	"PlayArmSequence": auth.Operator,
+	"StopArm":         auth.Operator,
+	"ScanLidar":       auth.Operator,
+	"PlayMelody":      auth.Operator,
+	"StopMelody":      auth.Operator,
+	"Sleep":           auth.Operator,
+	"Wake":            auth.Operator,
+	"SetBrake":        auth.Operator,
+
+	// Changing persistent settings
+	"SaveArmPose":     auth.Admin,
+	"SaveArmSequence": auth.Admin,
+}
+
+// methodLevel returns the access level required for the full method name,
+// e.g. "/package.RoverService/MoveRover"
+func methodLevel(fullMethod string) auth.Level {
+	if level, ok := methodLevels[fullMethod[strings.LastIndex(fullMethod, "/")+1:]]; ok {
+		return level
+	}
+	return auth.Admin
+}
@@ -0,0 +1,248 @@
+package rpc
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/dasfoo/rover/arm"
+	"github.com/dasfoo/rover/bb"
+	"github.com/dasfoo/rover/kinematics"
+	pb "github.com/dasfoo/rover/proto"
+)
+
+func getArmPose(in *pb.ArmPose) (arm.Pose, error) {
+	if in == nil {
+		return arm.Pose{}, bb.ErrAngleOutOfRange
+	}
+	angles := []int32{in.BasePan, in.BaseTilt, in.Elbow, in.WristRotate, in.WristTilt, in.Grip}
+	for _, angle := range angles {
+		if angle < 0 || angle > bb.MaxAngle {
+			return arm.Pose{}, bb.ErrAngleOutOfRange
+		}
+	}
+	return arm.Pose{
+		BasePan:     byte(in.BasePan),
+		BaseTilt:    byte(in.BaseTilt),
+		Elbow:       byte(in.Elbow),
+		WristRotate: byte(in.WristRotate),
+		WristTilt:   byte(in.WristTilt),
+		Grip:        byte(in.Grip),
+	}, nil
+}
+
+func newArmPose(pose arm.Pose) *pb.ArmPose {
+	return &pb.ArmPose{
+		BasePan:     int32(pose.BasePan),
+		BaseTilt:    int32(pose.BaseTilt),
+		Elbow:       int32(pose.Elbow),
+		WristRotate: int32(pose.WristRotate),
+		WristTilt:   int32(pose.WristTilt),
+		Grip:        int32(pose.Grip),
+	}
+}
+
+func newArmPosition(position kinematics.Position) *pb.ArmPosition {
+	return &pb.ArmPosition{
+		X:     position.X,
+		Y:     position.Y,
+		Z:     position.Z,
+		Pitch: position.Pitch,
+	}
+}
+
+// MoveArm moves all arm servos to the pose requested simultaneously, during the duration
+func (s *Server) MoveArm(ctx context.Context,
+	in *pb.MoveArmRequest) (*pb.MoveArmResponse, error) {
+	if s.Arm == nil {
+		return nil, ErrBoardSoftwareBlocked
+	}
+	target, err := getArmPose(in.Pose)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.wakeBoard(); err != nil {
+		return nil, err
+	}
+	err = s.Arm.Move(ctx, target, time.Duration(in.DurationMs)*time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+	pose, _ := s.Arm.Pose()
+	return &pb.MoveArmResponse{
+		Pose: newArmPose(pose),
+	}, nil
+}
+
+// GetArmPose returns the last pose commanded to the arm
+func (s *Server) GetArmPose(ctx context.Context,
+	in *pb.GetArmPoseRequest) (*pb.GetArmPoseResponse, error) {
+	if s.Arm == nil {
+		return nil, ErrBoardSoftwareBlocked
+	}
+	pose, known := s.Arm.Pose()
+	response := &pb.GetArmPoseResponse{
+		Pose:  newArmPose(pose),
+		Known: known,
+	}
+	if known && s.Kinematics != nil {
+		response.Position = newArmPosition(s.Kinematics.Forward(pose))
+	}
+	return response, nil
+}
+
+// MoveArmTo moves the gripper to the position requested, during the duration
+func (s *Server) MoveArmTo(ctx context.Context,
+	in *pb.MoveArmToRequest) (*pb.MoveArmToResponse, error) {
+	if s.Arm == nil || s.Kinematics == nil {
+		return nil, ErrBoardSoftwareBlocked
+	}
+	if in.Position == nil {
+		return nil, kinematics.ErrUnreachable
+	}
+	current, _ := s.Arm.Pose()
+	target, err := s.Kinematics.Inverse(kinematics.Position{
+		X:     in.Position.X,
+		Y:     in.Position.Y,
+		Z:     in.Position.Z,
+		Pitch: in.Position.Pitch,
+	}, current)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.wakeBoard(); err != nil {
+		return nil, err
+	}
+	err = s.Arm.Move(ctx, target, time.Duration(in.DurationMs)*time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+	pose, _ := s.Arm.Pose()
+	return &pb.MoveArmToResponse{
+		Pose:     newArmPose(pose),
+		Position: newArmPosition(s.Kinematics.Forward(pose)),
+	}, nil
+}
+
+// ListArmLibrary returns all named arm poses and sequences
+func (s *Server) ListArmLibrary(ctx context.Context,
+	in *pb.ListArmLibraryRequest) (*pb.ListArmLibraryResponse, error) {
+	if s.ArmLibrary == nil {
+		return nil, ErrBoardSoftwareBlocked
+	}
+	response := &pb.ListArmLibraryResponse{}
+	for _, name := range s.ArmLibrary.PoseNames() {
+		if pose, err := s.ArmLibrary.Pose(name); err == nil {
+			response.Poses = append(response.Poses, &pb.NamedArmPose{
+				Name: name,
+				Pose: newArmPose(pose),
+			})
+		}
+	}
+	for _, name := range s.ArmLibrary.SequenceNames() {
+		sequence, err := s.ArmLibrary.Sequence(name)
+		if err != nil {
+			continue
+		}
+		out := &pb.ArmSequence{Name: name}
+		for _, step := range sequence {
+			out.Steps = append(out.Steps, &pb.ArmSequenceStep{
+				Pose:       step.Pose,
+				DurationMs: step.DurationMs,
+				DelayMs:    step.DelayMs,
+			})
+		}
+		response.Sequences = append(response.Sequences, out)
+	}
+	return response, nil
+}
+
+// SaveArmPose stores a named pose; if the pose is omitted, the current arm pose is recorded
+func (s *Server) SaveArmPose(ctx context.Context,
+	in *pb.SaveArmPoseRequest) (*pb.SaveArmPoseResponse, error) {
+	if s.Arm == nil || s.ArmLibrary == nil {
+		return nil, ErrBoardSoftwareBlocked
+	}
+	if in.Pose == nil {
+		return nil, arm.ErrInvalidName
+	}
+	var (
+		pose  arm.Pose
+		err   error
+		known = true
+	)
+	if in.Pose.Pose == nil {
+		pose, known = s.Arm.Pose()
+	} else {
+		pose, err = getArmPose(in.Pose.Pose)
+	}
+	if !known {
+		return nil, ErrArmPoseUnknown
+	}
+	if err == nil {
+		err = s.ArmLibrary.SavePose(in.Pose.Name, pose)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pb.SaveArmPoseResponse{
+		Pose: &pb.NamedArmPose{
+			Name: in.Pose.Name,
+			Pose: newArmPose(pose),
+		},
+	}, nil
+}
+
+// SaveArmSequence stores a named sequence of steps referring to named poses
+func (s *Server) SaveArmSequence(ctx context.Context,
+	in *pb.SaveArmSequenceRequest) (*pb.SaveArmSequenceResponse, error) {
+	if s.ArmLibrary == nil {
+		return nil, ErrBoardSoftwareBlocked
+	}
+	if in.Sequence == nil {
+		return nil, arm.ErrInvalidName
+	}
+	var sequence arm.Sequence
+	for _, step := range in.Sequence.Steps {
+		sequence = append(sequence, arm.Step{
+			Pose:       step.Pose,
+			DurationMs: step.DurationMs,
+			DelayMs:    step.DelayMs,
+		})
+	}
+	if err := s.ArmLibrary.SaveSequence(in.Sequence.Name, sequence); err != nil {
+		return nil, err
+	}
+	return &pb.SaveArmSequenceResponse{}, nil
+}
+
+// PlayArmSequence plays the named sequence until it's finished, aborted or cancelled
+func (s *Server) PlayArmSequence(ctx context.Context,
+	in *pb.PlayArmSequenceRequest) (*pb.PlayArmSequenceResponse, error) {
+	if s.Arm == nil || s.ArmLibrary == nil {
+		return nil, ErrBoardSoftwareBlocked
+	}
+	if err := s.wakeBoard(); err != nil {
+		return nil, err
+	}
+	if err := s.Arm.Play(ctx, s.ArmLibrary, in.Name); err != nil {
+		return nil, err
+	}
+	pose, _ := s.Arm.Pose()
+	return &pb.PlayArmSequenceResponse{
+		Pose: newArmPose(pose),
+	}, nil
+}
+
+// StopArm aborts the arm movement or sequence in progress
+func (s *Server) StopArm(ctx context.Context,
+	in *pb.StopArmRequest) (*pb.StopArmResponse, error) {
+	if s.Arm == nil {
+		return nil, ErrBoardSoftwareBlocked
+	}
+	s.Arm.Stop()
+	pose, _ := s.Arm.Pose()
+	return &pb.StopArmResponse{
+		Pose: newArmPose(pose),
+	}, nil
+}
@@ -0,0 +1,208 @@
+package rpc
+
+import (
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/dasfoo/rover/guard"
+	"github.com/dasfoo/rover/mc"
+	pb "github.com/dasfoo/rover/proto"
+)
+
+// DefaultDriveTimeout is used when Server.DriveTimeout is not set
+const DefaultDriveTimeout = 500 * time.Millisecond
+
+// moveRoverDuration is how long the motors run after a single MoveRover call
+const moveRoverDuration = 1 * time.Second
+
+// watchdog stops the motors unless it is kicked again within the timeout.
+// Every Drive stream and MoveRover call is a separate owner of the motors; only the last one
+// to set the speed may stop them when it ends.
+type watchdog struct {
+	mu         sync.Mutex
+	timer      *time.Timer
+	generation int
+	// owner is the session which set the motors speed last, 0 if none
+	owner int
+	// sessions is the last session number given out
+	sessions int
+}
+
+// newDriveSession returns a new owner number for setMotors
+func (s *Server) newDriveSession() int {
+	s.watchdog.mu.Lock()
+	defer s.watchdog.mu.Unlock()
+	s.watchdog.sessions++
+	return s.watchdog.sessions
+}
+
+// kickWatchdog (re)arms the watchdog to stop the motors after timeout; call with the lock held
+func (s *Server) kickWatchdog(timeout time.Duration) {
+	if s.watchdog.timer != nil {
+		s.watchdog.timer.Stop()
+	}
+	s.watchdog.generation++
+	generation := s.watchdog.generation
+	s.watchdog.timer = time.AfterFunc(timeout, func() {
+		s.watchdog.mu.Lock()
+		defer s.watchdog.mu.Unlock()
+		// Ignore the timer if the watchdog has been kicked after it fired
+		if generation != s.watchdog.generation {
+			return
+		}
+		log.Println("Drive watchdog timeout, stopping motors")
+		s.watchdog.owner = 0
+		if err := s.stopMotors(); err != nil {
+			log.Println("Failed to stop motors:", err)
+		}
+	})
+}
+
+// disarmWatchdog stops the motors immediately and cancels the pending timeout
+func (s *Server) disarmWatchdog() error {
+	s.watchdog.mu.Lock()
+	defer s.watchdog.mu.Unlock()
+	return s.disarmWatchdogLocked()
+}
+
+func (s *Server) disarmWatchdogLocked() error {
+	if s.watchdog.timer != nil {
+		s.watchdog.timer.Stop()
+	}
+	s.watchdog.generation++
+	s.watchdog.owner = 0
+	return s.stopMotors()
+}
+
+// releaseMotors stops the motors unless another session has set their speed since the owner
+func (s *Server) releaseMotors(owner int) error {
+	s.watchdog.mu.Lock()
+	defer s.watchdog.mu.Unlock()
+	if s.watchdog.owner != owner {
+		return nil
+	}
+	return s.disarmWatchdogLocked()
+}
+
+// setMotors validates the speeds, stops closed-loop movement in progress, limits the speeds
+// with the Guard unless overridden, and starts motors on behalf of the owner, to be stopped
+// by the watchdog after timeout
+func (s *Server) setMotors(ctx context.Context, in *pb.RoverWheelRequest,
+	owner int, timeout time.Duration) (*pb.RoverWheelResponse, error) {
+	if err := mc.CheckSpeed(int(in.Left)); err != nil {
+		return nil, err
+	}
+	if err := mc.CheckSpeed(int(in.Right)); err != nil {
+		return nil, err
+	}
+	if err := s.wakeMotors(); err != nil {
+		return nil, err
+	}
+	guarded := s.Guard != nil && !in.OverrideGuard
+	if guarded && s.Board != nil {
+		// The Guard needs LIDAR tilt servo
+		if err := s.wakeBoard(); err != nil {
+			return nil, err
+		}
+	}
+	if s.Motion != nil {
+		// Manual drive takes over from DriveDistance or Rotate in progress
+		s.Motion.Stop()
+	}
+	left, right := int8(in.Left), int8(in.Right)
+	var limit guard.Limit
+	if guarded {
+		left, right, limit = s.Guard.Limit(ctx, left, right)
+		if limit.Limited {
+			log.Println("Drive limited:", limit.Reason)
+		}
+	}
+
+	s.watchdog.mu.Lock()
+	defer s.watchdog.mu.Unlock()
+	s.watchdog.owner = owner
+	// Arm the watchdog first, so that the motors are stopped even if setting one side fails
+	s.kickWatchdog(timeout)
+	if err := s.Motors.Left(left); err != nil {
+		return nil, err
+	}
+	if err := s.Motors.Right(right); err != nil {
+		return nil, err
+	}
+	return &pb.RoverWheelResponse{
+		Left:     int32(left),
+		Right:    int32(right),
+		Limited:  limit.Limited,
+		Reason:   limit.Reason,
+		Distance: int32(limit.Distance),
+	}, nil
+}
+
+func (s *Server) stopMotors() error {
+	return s.Motors.Stop()
+}
+
+func (s *Server) driveTimeout() time.Duration {
+	if s.DriveTimeout > 0 {
+		return s.DriveTimeout
+	}
+	return DefaultDriveTimeout
+}
+
+// Drive receives a stream of motor setpoints and acknowledges each of them.
+// Motors are stopped when no setpoint arrives within DriveTimeout, or the stream is closed
+// (unless another client has taken over the motors).
+func (s *Server) Drive(stream pb.RoverService_DriveServer) error {
+	if s.Motors == nil {
+		return ErrMotorsSoftwareBlocked
+	}
+	owner := s.newDriveSession()
+	defer func() {
+		if err := s.releaseMotors(owner); err != nil {
+			log.Println("Failed to stop motors:", err)
+		}
+	}()
+
+	var (
+		requests = make(chan *pb.RoverWheelRequest)
+		recvErr  = make(chan error, 1)
+		done     = make(chan struct{})
+	)
+	defer close(done)
+	go func() {
+		for {
+			in, err := stream.Recv()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			select {
+			case requests <- in:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case in := <-requests:
+			resp, err := s.setMotors(stream.Context(), in, owner, s.driveTimeout())
+			if err != nil {
+				return err
+			}
+			if err = stream.Send(resp); err != nil {
+				return err
+			}
+		case err := <-recvErr:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
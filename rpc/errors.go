@@ -0,0 +1,131 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/dasfoo/rover/arm"
+	"github.com/dasfoo/rover/auth"
+	"github.com/dasfoo/rover/bb"
+	"github.com/dasfoo/rover/kinematics"
+	"github.com/dasfoo/rover/mc"
+	"github.com/dasfoo/rover/motion"
+	"github.com/dasfoo/rover/scan"
+)
+
+// Error definitions
+var (
+	ErrMotorsSoftwareBlocked = errors.New("Motors controller is software blocked")
+	ErrBoardSoftwareBlocked  = errors.New("Board controller is software blocked")
+	ErrOdometryDisabled      = errors.New("Odometry is not running")
+	ErrArmPoseUnknown        = errors.New("Arm pose is unknown until it's moved")
+	ErrScannerDisabled       = errors.New("LIDAR scanner is not available")
+	ErrTelemetryDisabled     = errors.New("Telemetry is not running")
+	ErrBusStatsDisabled      = errors.New("Bus stats are not collected")
+	ErrBatteryLow            = errors.New("Controllers are asleep to save the battery")
+)
+
+// Metadata keys attached to the trailer of a failed call to describe the error
+const (
+	errorStatusBitsKey   = "error-status-bits"
+	errorRequiredBitsKey = "error-required-bits"
+	// Distance or angle covered by DriveDistance or Rotate before it failed or was cancelled
+	errorAchievedMetersKey  = "error-achieved-meters"
+	errorAchievedDegreesKey = "error-achieved-degrees"
+)
+
+// isTimeout checks whether err is a timeout of i/o operation (e.g. on i2c bus)
+func isTimeout(err error) bool {
+	switch e := err.(type) {
+	case *os.PathError:
+		return isTimeout(e.Err)
+	case *os.SyscallError:
+		return isTimeout(e.Err)
+	case syscall.Errno:
+		return e == syscall.ETIMEDOUT
+	case interface {
+		Timeout() bool
+	}:
+		return e.Timeout()
+	}
+	return false
+}
+
+// getGRPCCode finds the most appropriate GRPC status code for the error
+func getGRPCCode(err error) codes.Code {
+	switch err {
+	case auth.ErrUnknownUser, auth.ErrIncorrectToken, auth.ErrSessionExpired:
+		return codes.Unauthenticated
+	case auth.ErrAccessDenied:
+		return codes.PermissionDenied
+	case auth.ErrCannotVerify:
+		// The stored credential is unusable, which is a server misconfiguration
+		return codes.Internal
+	case ErrMotorsSoftwareBlocked, ErrBoardSoftwareBlocked, ErrOdometryDisabled,
+		ErrScannerDisabled, ErrTelemetryDisabled, ErrBusStatsDisabled:
+		return codes.Unimplemented
+	case mc.ErrSpeedOutOfRange, bb.ErrAngleOutOfRange,
+		motion.ErrInvalidSpeed, motion.ErrInvalidTarget, kinematics.ErrUnreachable,
+		scan.ErrInvalidStep, bb.ErrMelodyTooLong, bb.ErrInvalidNote:
+		return codes.InvalidArgument
+	case arm.ErrUnknownPose, arm.ErrUnknownSequence:
+		return codes.NotFound
+	case arm.ErrInvalidName:
+		return codes.InvalidArgument
+	case auth.ErrLockedOut:
+		return codes.ResourceExhausted
+	case ErrArmPoseUnknown, ErrBatteryLow:
+		return codes.FailedPrecondition
+	case motion.ErrStalled, motion.ErrBlocked:
+		return codes.Aborted
+	case context.Canceled:
+		return codes.Canceled
+	case context.DeadlineExceeded:
+		return codes.DeadlineExceeded
+	}
+	if _, ok := err.(*bb.StatusError); ok {
+		return codes.FailedPrecondition
+	}
+	if isTimeout(err) {
+		return codes.DeadlineExceeded
+	}
+	return codes.Unavailable
+}
+
+// getGRPCError translates hardware errors into GRPC errors.
+func (s *Server) getGRPCError(err error) error {
+	if grpc.Code(err) != codes.Unknown {
+		// Already a GRPC error
+		return err
+	}
+	return grpc.Errorf(getGRPCCode(err), "%s", err.Error())
+}
+
+// getErrorTrailer returns metadata with machine-readable error details, if there are any
+func getErrorTrailer(err error) metadata.MD {
+	if se, ok := err.(*bb.StatusError); ok {
+		return metadata.Pairs(
+			errorStatusBitsKey, fmt.Sprintf("%.16b", se.Status),
+			errorRequiredBitsKey, fmt.Sprintf("%.16b", se.Required),
+		)
+	}
+	return nil
+}
+
+// setAchievedTrailer attaches the progress of a failed movement to the call trailer
+func setAchievedTrailer(ctx context.Context, key string, value float64) {
+	md := metadata.Pairs(key, strconv.FormatFloat(value, 'f', -1, 64))
+	if err := grpc.SetTrailer(ctx, md); err != nil {
+		log.Println("Failed to set error trailer:", err)
+	}
+}
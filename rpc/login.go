@@ -0,0 +1,32 @@
+package rpc
+
+import (
+	"golang.org/x/net/context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	pb "github.com/dasfoo/rover/proto"
+)
+
+// Login exchanges the user token in request metadata for a short-lived session token,
+// or refreshes the session token. Clients send the session token instead of the user token
+// in further calls and camera requests, until it expires.
+func (s *Server) Login(ctx context.Context, in *pb.LoginRequest) (*pb.LoginResponse, error) {
+	if s.AM == nil {
+		return &pb.LoginResponse{}, nil
+	}
+	user, token, err := getUserAndToken(ctx)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "%s", err.Error())
+	}
+	session, err := s.AM.Login(user, token)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.LoginResponse{
+		Token:     session.Token,
+		Role:      session.Role.String(),
+		ExpiresAt: session.Expires.UnixNano(),
+	}, nil
+}
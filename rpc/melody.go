@@ -0,0 +1,45 @@
+package rpc
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/dasfoo/rover/bb"
+	pb "github.com/dasfoo/rover/proto"
+)
+
+// PlayMelody plays the notes on the Board speaker, interrupting the melody currently playing.
+// It returns as soon as the melody starts.
+func (s *Server) PlayMelody(ctx context.Context,
+	in *pb.PlayMelodyRequest) (*pb.PlayMelodyResponse, error) {
+	if s.Board == nil {
+		return nil, ErrBoardSoftwareBlocked
+	}
+	notes := make([]bb.Note, len(in.Notes))
+	for i, note := range in.Notes {
+		if note.Frequency < 0 || note.Frequency > 0xffff || note.DurationMs < 0 {
+			return nil, bb.ErrInvalidNote
+		}
+		notes[i] = bb.Note{
+			Frequency: uint16(note.Frequency),
+			Duration:  time.Duration(note.DurationMs) * time.Millisecond,
+		}
+	}
+	if err := s.Board.PlayMelody(notes); err != nil {
+		return nil, err
+	}
+	return &pb.PlayMelodyResponse{}, nil
+}
+
+// StopMelody stops the melody playing on the Board speaker
+func (s *Server) StopMelody(ctx context.Context,
+	in *pb.StopMelodyRequest) (*pb.StopMelodyResponse, error) {
+	if s.Board == nil {
+		return nil, ErrBoardSoftwareBlocked
+	}
+	if err := s.Board.StopMelody(); err != nil {
+		return nil, err
+	}
+	return &pb.StopMelodyResponse{}, nil
+}
@@ -0,0 +1,66 @@
+package rpc
+
+import (
+	"golang.org/x/net/context"
+
+	"github.com/dasfoo/rover/mc"
+	pb "github.com/dasfoo/rover/proto"
+)
+
+// DriveDistance moves the rover straight for the distance requested, until done or cancelled.
+// If it fails or is cancelled, the distance covered is in the error-achieved-meters trailer.
+func (s *Server) DriveDistance(ctx context.Context,
+	in *pb.DriveDistanceRequest) (*pb.DriveDistanceResponse, error) {
+	if s.Motion == nil {
+		return nil, ErrMotorsSoftwareBlocked
+	}
+	if err := s.disarmWatchdog(); err != nil {
+		return nil, err
+	}
+	if err := mc.CheckSpeed(int(in.Speed)); err != nil {
+		return nil, err
+	}
+	if err := s.wakeMotors(); err != nil {
+		return nil, err
+	}
+	if s.Guard != nil && s.Board != nil && in.Meters > 0 {
+		// The Guard needs LIDAR tilt servo
+		if err := s.wakeBoard(); err != nil {
+			return nil, err
+		}
+	}
+	meters, err := s.Motion.DriveDistance(ctx, in.Meters, int8(in.Speed))
+	if err != nil {
+		setAchievedTrailer(ctx, errorAchievedMetersKey, meters)
+		return nil, err
+	}
+	return &pb.DriveDistanceResponse{
+		Meters: meters,
+	}, nil
+}
+
+// Rotate turns the rover in place for the angle requested, until done or cancelled.
+// If it fails or is cancelled, the angle turned is in the error-achieved-degrees trailer.
+func (s *Server) Rotate(ctx context.Context,
+	in *pb.RotateRequest) (*pb.RotateResponse, error) {
+	if s.Motion == nil {
+		return nil, ErrMotorsSoftwareBlocked
+	}
+	if err := s.disarmWatchdog(); err != nil {
+		return nil, err
+	}
+	if err := mc.CheckSpeed(int(in.Speed)); err != nil {
+		return nil, err
+	}
+	if err := s.wakeMotors(); err != nil {
+		return nil, err
+	}
+	degrees, err := s.Motion.Rotate(ctx, in.Degrees, int8(in.Speed))
+	if err != nil {
+		setAchievedTrailer(ctx, errorAchievedDegreesKey, degrees)
+		return nil, err
+	}
+	return &pb.RotateResponse{
+		Degrees: degrees,
+	}, nil
+}
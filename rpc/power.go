@@ -0,0 +1,134 @@
+package rpc
+
+import (
+	"log"
+
+	"golang.org/x/net/context"
+
+	"github.com/dasfoo/rover/power"
+	pb "github.com/dasfoo/rover/proto"
+)
+
+// checkPower refuses to wake controllers up when they are asleep to save the battery
+func (s *Server) checkPower() error {
+	if s.Power != nil {
+		if state, _, _ := s.Power.Status(); state >= power.Critical {
+			return ErrBatteryLow
+		}
+	}
+	return nil
+}
+
+// wakeMotors wakes the Motors up for a motion command, if they are asleep
+func (s *Server) wakeMotors() error {
+	if s.Motors == nil {
+		return ErrMotorsSoftwareBlocked
+	}
+	if s.Motors.Awake() {
+		return nil
+	}
+	if err := s.checkPower(); err != nil {
+		return err
+	}
+	log.Println("Waking motors up for a motion command")
+	return s.Motors.Wake()
+}
+
+// wakeBoard wakes the Board (servos) up for a motion command, if it is asleep
+func (s *Server) wakeBoard() error {
+	if s.Board == nil {
+		return ErrBoardSoftwareBlocked
+	}
+	if s.Board.Awake() {
+		return nil
+	}
+	if err := s.checkPower(); err != nil {
+		return err
+	}
+	log.Println("Waking board up for a motion command")
+	return s.Board.Wake()
+}
+
+func (s *Server) getControllerState() *pb.ControllerState {
+	state := &pb.ControllerState{}
+	if s.Board != nil {
+		state.BoardAwake = s.Board.Awake()
+	}
+	if s.Motors != nil {
+		state.MotorsAwake = s.Motors.Awake()
+		state.Brake = s.Motors.Braking()
+	}
+	return state
+}
+
+// GetControllerState returns the power and brake state last commanded to the controllers
+func (s *Server) GetControllerState(ctx context.Context,
+	in *pb.GetControllerStateRequest) (*pb.ControllerState, error) {
+	return s.getControllerState(), nil
+}
+
+// Sleep reduces power usage of the controllers selected (both if none is selected).
+// Motors are stopped first.
+func (s *Server) Sleep(ctx context.Context, in *pb.SleepRequest) (*pb.ControllerState, error) {
+	all := !in.Board && !in.Motors
+	if in.Motors || all {
+		if s.Motors == nil {
+			return nil, ErrMotorsSoftwareBlocked
+		}
+		if s.Motion != nil {
+			s.Motion.Stop()
+		}
+		if err := s.disarmWatchdog(); err != nil {
+			return nil, err
+		}
+		if err := s.Motors.Sleep(); err != nil {
+			return nil, err
+		}
+	}
+	if in.Board || all {
+		if s.Board == nil {
+			return nil, ErrBoardSoftwareBlocked
+		}
+		if s.Arm != nil {
+			s.Arm.Stop()
+		}
+		if err := s.Board.Sleep(); err != nil {
+			return nil, err
+		}
+	}
+	return s.getControllerState(), nil
+}
+
+// Wake re-enables the controllers selected (both if none is selected)
+func (s *Server) Wake(ctx context.Context, in *pb.WakeRequest) (*pb.ControllerState, error) {
+	all := !in.Board && !in.Motors
+	if in.Motors || all {
+		if s.Motors == nil {
+			return nil, ErrMotorsSoftwareBlocked
+		}
+		if err := s.Motors.Wake(); err != nil {
+			return nil, err
+		}
+	}
+	if in.Board || all {
+		if s.Board == nil {
+			return nil, ErrBoardSoftwareBlocked
+		}
+		if err := s.Board.Wake(); err != nil {
+			return nil, err
+		}
+	}
+	return s.getControllerState(), nil
+}
+
+// SetBrake enables or disables holding the wheels in place when the motors are stopped
+func (s *Server) SetBrake(ctx context.Context,
+	in *pb.SetBrakeRequest) (*pb.ControllerState, error) {
+	if s.Motors == nil {
+		return nil, ErrMotorsSoftwareBlocked
+	}
+	if err := s.Motors.Brake(in.Brake); err != nil {
+		return nil, err
+	}
+	return s.getControllerState(), nil
+}
@@ -0,0 +1,43 @@
+package rpc
+
+import (
+	"github.com/dasfoo/rover/bb"
+	pb "github.com/dasfoo/rover/proto"
+	"github.com/dasfoo/rover/scan"
+)
+
+// ScanLidar sweeps LIDAR with the tilt servo and streams distance measured at every angle.
+// In continuous mode, it keeps sweeping back and forth until the client cancels the call.
+func (s *Server) ScanLidar(in *pb.ScanLidarRequest, stream pb.RoverService_ScanLidarServer) error {
+	if s.Scanner == nil {
+		return ErrScannerDisabled
+	}
+	if in.From < 0 || in.From > 255 || in.To < 0 || in.To > 255 {
+		return bb.ErrAngleOutOfRange
+	}
+	if in.Step <= 0 || in.Step > 255 {
+		return scan.ErrInvalidStep
+	}
+	if s.Board != nil {
+		if err := s.wakeBoard(); err != nil {
+			return err
+		}
+	}
+	from, to := byte(in.From), byte(in.To)
+	send := func(p scan.Point) error {
+		return stream.Send(&pb.ScanPoint{
+			Angle:     int32(p.Angle),
+			Distance:  int32(p.Distance),
+			Timestamp: p.Time.UnixNano(),
+		})
+	}
+	for {
+		if err := s.Scanner.Sweep(stream.Context(), from, to, byte(in.Step), send); err != nil {
+			return err
+		}
+		if !in.Continuous {
+			return nil
+		}
+		from, to = to, from
+	}
+}
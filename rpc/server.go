@@ -3,6 +3,8 @@ package rpc
 import (
 	"errors"
 	"fmt"
+	"log"
+	"sort"
 	"time"
 
 	"golang.org/x/net/context"
@@ -10,11 +12,23 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 
+	"github.com/dasfoo/rover/arbiter"
+	"github.com/dasfoo/rover/arm"
 	"github.com/dasfoo/rover/auth"
+	"github.com/dasfoo/rover/battery"
 	"github.com/dasfoo/rover/bb"
+	"github.com/dasfoo/rover/guard"
+	"github.com/dasfoo/rover/kinematics"
 	"github.com/dasfoo/rover/mc"
+	"github.com/dasfoo/rover/motion"
+	"github.com/dasfoo/rover/odometry"
+	"github.com/dasfoo/rover/power"
 	pb "github.com/dasfoo/rover/proto"
+	"github.com/dasfoo/rover/scan"
+	"github.com/dasfoo/rover/supervisor"
+	"github.com/dasfoo/rover/telemetry"
 )
 
 // Server is an implementation of roverserver.RoverServiceServer.
@@ -22,6 +36,34 @@ type Server struct {
 	AM     *auth.Manager
 	Motors *mc.MC
 	Board  *bb.BB
+	// Battery is optional, measures the battery connected to the Board
+	Battery *battery.Monitor
+	// Power is optional, takes actions to save the Battery
+	Power *power.Policy
+	// Arm is optional, controls the robotic arm attached to the Board
+	Arm *arm.Arm
+	// Kinematics is optional, describes the Arm geometry for MoveArmTo
+	Kinematics *kinematics.Config
+	// ArmLibrary is optional, contains named poses and sequences for the Arm
+	ArmLibrary *arm.Library
+	// Odometry is optional, fed by the Motors encoders
+	Odometry *odometry.Odometry
+	// Motion is optional, provides closed-loop movement with Motors
+	Motion *motion.Controller
+	// Scanner is optional, sweeps LIDAR mounted on the Board tilt servo
+	Scanner *scan.Scanner
+	// Telemetry is optional, samples Board and Motors sensors for SubscribeTelemetry
+	Telemetry *telemetry.Poller
+	// Bus is optional, provides i2c bus stats
+	Bus *arbiter.Arbiter
+	// BoardHealth is optional, resets the Board when it stops responding
+	BoardHealth *supervisor.Supervisor
+	// Guard is optional, limits forward speed of MoveRover and Drive near obstacles
+	Guard *guard.Guard
+	// DriveTimeout is the maximum interval between Drive commands before motors are stopped
+	DriveTimeout time.Duration
+
+	watchdog watchdog
 }
 
 // CreateGRPCServer returns a new GRPC server instance with RoverService registered
@@ -35,18 +77,6 @@ func (s *Server) CreateGRPCServer() *grpc.Server {
 	return server
 }
 
-// Error definitions
-var (
-	ErrMotorsSoftwareBlocked = errors.New("Motors controller is software blocked")
-	ErrBoardSoftwareBlocked  = errors.New("Board controller is software blocked")
-)
-
-// getGRPCError translates hardware errors into GRPC errors.
-func (s *Server) getGRPCError(err error) error {
-	// TODO(dotdoom): support more error conditions
-	return grpc.Errorf(codes.Unavailable, "%s", err.Error())
-}
-
 const (
 	authUserKey  = "auth-user"
 	authTokenKey = "auth-token"
@@ -73,71 +103,84 @@ func getUserAndToken(ctx context.Context) (string, string, error) {
 	return user, token, err
 }
 
-func (s *Server) checkAccess(ctx context.Context) error {
+func (s *Server) checkAccess(ctx context.Context, fullMethod string) error {
 	if s.AM == nil {
 		return nil
 	}
+	var address string
+	if p, ok := peer.FromContext(ctx); ok {
+		address = p.Addr.String()
+	}
+	level := methodLevel(fullMethod)
 	user, token, err := getUserAndToken(ctx)
 	if err != nil {
-		return err
+		s.AM.Audit(address, fullMethod, user, level, err)
+		return grpc.Errorf(codes.Unauthenticated, "%s", err.Error())
 	}
-	return s.AM.CheckAccess(user, token)
+	return s.AM.Authorize(address, fullMethod, user, token, level)
 }
 
 func (s *Server) streamInterceptor(srv interface{}, stream grpc.ServerStream,
 	info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
-	if err := s.checkAccess(stream.Context()); err != nil {
-		return err
+	err := s.checkAccess(stream.Context(), info.FullMethod)
+	if err == nil {
+		err = handler(srv, stream)
+	}
+	if err != nil {
+		if md := getErrorTrailer(err); md != nil {
+			stream.SetTrailer(md)
+		}
+		return s.getGRPCError(err)
 	}
-	// TODO(dotdoom): process error from handler to getGRPCError automatically if needed.
-	return handler(srv, stream)
+	return nil
 }
 
 func (s *Server) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
 	handler grpc.UnaryHandler) (interface{}, error) {
-	if err := s.checkAccess(ctx); err != nil {
-		return nil, err
+	err := s.checkAccess(ctx, info.FullMethod)
+	var resp interface{}
+	if err == nil {
+		resp, err = handler(ctx, req)
+	}
+	if err != nil {
+		if md := getErrorTrailer(err); md != nil {
+			if trailerErr := grpc.SetTrailer(ctx, md); trailerErr != nil {
+				log.Println("Failed to set error trailer:", trailerErr)
+			}
+		}
+		return nil, s.getGRPCError(err)
 	}
-	// TODO(dotdoom): process error from handler to getGRPCError automatically if needed.
-	return handler(ctx, req)
+	return resp, nil
 }
 
-// MoveRover is an example of using motors
+// MoveRover starts motors, which are stopped by the watchdog unless another command arrives.
+// Forward speed may be limited by the Guard, as reported in the response.
 func (s *Server) MoveRover(ctx context.Context,
 	in *pb.RoverWheelRequest) (*pb.RoverWheelResponse, error) {
 	if s.Motors == nil {
 		return nil, ErrMotorsSoftwareBlocked
 	}
-	if err := s.Motors.Left(int8(in.Left)); err != nil {
-		return nil, err
-	}
-	if err := s.Motors.Right(int8(in.Right)); err != nil {
-		return nil, err
-	}
-	time.Sleep(1 * time.Second)
+	return s.setMotors(ctx, in, s.newDriveSession(), moveRoverDuration)
+}
 
-	if err := s.Motors.Left(0); err != nil {
-		return nil, err
-	}
-	if err := s.Motors.Right(0); err != nil {
-		return nil, err
+func newBatteryPercentage(reading battery.Reading) *pb.BatteryPercentageResponse {
+	return &pb.BatteryPercentageResponse{
+		Battery: int32(reading.Percentage + 0.5),
+		Voltage: reading.Voltage,
 	}
-	return &pb.RoverWheelResponse{}, nil
 }
 
-// GetBatteryPercentage returns battery value as reported by the Board
+// GetBatteryPercentage returns battery charge and voltage, filtered and calibrated
 func (s *Server) GetBatteryPercentage(ctx context.Context,
 	in *pb.BatteryPercentageRequest) (*pb.BatteryPercentageResponse, error) {
-	if s.Board == nil {
+	if s.Battery == nil {
 		return nil, ErrBoardSoftwareBlocked
 	}
-	batteryPercentage, err := s.Board.GetBatteryPercentage()
+	reading, err := s.Battery.Read()
 	if err != nil {
-		return nil, s.getGRPCError(err)
+		return nil, err
 	}
-	return &pb.BatteryPercentageResponse{
-		Battery: int32(batteryPercentage),
-	}, nil
+	return newBatteryPercentage(reading), nil
 }
 
 // GetAmbientLight uses ambient light sensor
@@ -148,7 +191,7 @@ func (s *Server) GetAmbientLight(ctx context.Context,
 	}
 	light, err := s.Board.GetAmbientLight()
 	if err != nil {
-		return nil, s.getGRPCError(err)
+		return nil, err
 	}
 	return &pb.AmbientLightResponse{
 		Light: int32(light),
@@ -163,7 +206,7 @@ func (s *Server) GetTemperatureAndHumidity(ctx context.Context,
 	}
 	t, h, err := s.Board.GetTemperatureAndHumidity()
 	if err != nil {
-		return nil, s.getGRPCError(err)
+		return nil, err
 	}
 	return &pb.TemperatureAndHumidityResponse{
 		Temperature: int32(t),
@@ -183,16 +226,16 @@ func (s *Server) ReadEncoders(ctx context.Context,
 		err                                        error
 	)
 	if leftFront, err = s.Motors.ReadEncoder(mc.EncoderLeftFront); err != nil {
-		return nil, s.getGRPCError(err)
+		return nil, err
 	}
 	if leftBack, err = s.Motors.ReadEncoder(mc.EncoderLeftBack); err != nil {
-		return nil, s.getGRPCError(err)
+		return nil, err
 	}
 	if rightFront, err = s.Motors.ReadEncoder(mc.EncoderRightFront); err != nil {
-		return nil, s.getGRPCError(err)
+		return nil, err
 	}
 	if rightBack, err = s.Motors.ReadEncoder(mc.EncoderRightBack); err != nil {
-		return nil, s.getGRPCError(err)
+		return nil, err
 	}
 	return &pb.ReadEncodersResponse{
 		LeftFront:  leftFront,
@@ -201,3 +244,90 @@ func (s *Server) ReadEncoders(ctx context.Context,
 		RightBack:  rightBack,
 	}, nil
 }
+
+// GetPose returns the rover position and heading estimated by odometry
+func (s *Server) GetPose(ctx context.Context,
+	in *pb.GetPoseRequest) (*pb.GetPoseResponse, error) {
+	if s.Odometry == nil {
+		return nil, ErrOdometryDisabled
+	}
+	pose := s.Odometry.Pose()
+	return &pb.GetPoseResponse{
+		X:     pose.X,
+		Y:     pose.Y,
+		Theta: pose.Theta,
+	}, nil
+}
+
+// ResetPose makes the current rover position and heading an origin for odometry
+func (s *Server) ResetPose(ctx context.Context,
+	in *pb.ResetPoseRequest) (*pb.ResetPoseResponse, error) {
+	if s.Odometry == nil {
+		return nil, ErrOdometryDisabled
+	}
+	s.Odometry.Reset()
+	return &pb.ResetPoseResponse{}, nil
+}
+
+// GetBusStats returns i2c transaction counts, errors and latency for every device on the bus,
+// ordered by address
+func (s *Server) GetBusStats(ctx context.Context,
+	in *pb.GetBusStatsRequest) (*pb.GetBusStatsResponse, error) {
+	if s.Bus == nil {
+		return nil, ErrBusStatsDisabled
+	}
+	devices := s.Bus.Stats()
+	addresses := make([]int, 0, len(devices))
+	for addr := range devices {
+		addresses = append(addresses, int(addr))
+	}
+	sort.Ints(addresses)
+	resp := &pb.GetBusStatsResponse{}
+	for _, addr := range addresses {
+		stats := devices[byte(addr)]
+		resp.Devices = append(resp.Devices, &pb.BusDeviceStats{
+			Address:      int32(addr),
+			Transactions: stats.Transactions,
+			Errors:       stats.Errors,
+			LatencyNs:    int64(stats.Latency),
+			MaxLatencyNs: int64(stats.MaxLatency),
+			WaitNs:       int64(stats.Wait),
+		})
+	}
+	return resp, nil
+}
+
+// GetBoardHealth returns how many times the Board has been reset because it stopped responding
+func (s *Server) GetBoardHealth(ctx context.Context,
+	in *pb.GetBoardHealthRequest) (*pb.GetBoardHealthResponse, error) {
+	if s.BoardHealth == nil {
+		return nil, ErrBoardSoftwareBlocked
+	}
+	health := s.BoardHealth.Health()
+	resp := &pb.GetBoardHealthResponse{
+		Resets:   int32(health.Resets),
+		Failures: int32(health.Failures),
+	}
+	if !health.LastReset.IsZero() {
+		resp.LastReset = health.LastReset.UnixNano()
+		resp.LastResetReason = health.LastResetReason.Error()
+	}
+	return resp, nil
+}
+
+// GetPowerState returns the power state decided by the battery level, and the battery reading
+func (s *Server) GetPowerState(ctx context.Context,
+	in *pb.GetPowerStateRequest) (*pb.GetPowerStateResponse, error) {
+	if s.Power == nil {
+		return nil, ErrBoardSoftwareBlocked
+	}
+	state, reading, err := s.Power.Status()
+	resp := &pb.GetPowerStateResponse{
+		State:   pb.PowerState(state),
+		Battery: newBatteryPercentage(reading),
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	return resp, nil
+}
@@ -0,0 +1,86 @@
+package rpc
+
+import (
+	"time"
+
+	pb "github.com/dasfoo/rover/proto"
+	"github.com/dasfoo/rover/telemetry"
+)
+
+func newTelemetry(snapshot telemetry.Snapshot) *pb.Telemetry {
+	t := &pb.Telemetry{
+		Timestamp: snapshot.Time.UnixNano(),
+	}
+	measured := func(sensor telemetry.Sensors) int64 {
+		return snapshot.Measured[sensor].UnixNano()
+	}
+	if snapshot.Sensors&telemetry.Battery != 0 {
+		t.Battery = newBatteryPercentage(snapshot.Battery)
+		t.BatteryTimestamp = measured(telemetry.Battery)
+	}
+	if snapshot.Sensors&telemetry.AmbientLight != 0 {
+		t.AmbientLight = &pb.AmbientLightResponse{
+			Light: int32(snapshot.Light),
+		}
+		t.AmbientLightTimestamp = measured(telemetry.AmbientLight)
+	}
+	if snapshot.Sensors&telemetry.Environment != 0 {
+		t.TemperatureAndHumidity = &pb.TemperatureAndHumidityResponse{
+			Temperature: int32(snapshot.Temperature),
+			Humidity:    int32(snapshot.Humidity),
+		}
+		t.TemperatureAndHumidityTimestamp = measured(telemetry.Environment)
+	}
+	if snapshot.Sensors&telemetry.Encoders != 0 {
+		t.Encoders = &pb.ReadEncodersResponse{
+			LeftFront:  snapshot.LeftFront,
+			LeftBack:   snapshot.LeftBack,
+			RightFront: snapshot.RightFront,
+			RightBack:  snapshot.RightBack,
+		}
+		t.EncodersTimestamp = measured(telemetry.Encoders)
+	}
+	for _, err := range snapshot.Errors {
+		// Error message is prefixed with the sensor name
+		t.Errors = append(t.Errors, err.Error())
+	}
+	return t
+}
+
+// SubscribeTelemetry streams snapshots of the sensors requested every interval, until
+// the client cancels the call. Sensors which failed to read are reported as errors.
+func (s *Server) SubscribeTelemetry(in *pb.SubscribeTelemetryRequest,
+	stream pb.RoverService_SubscribeTelemetryServer) error {
+	if s.Telemetry == nil {
+		return ErrTelemetryDisabled
+	}
+	var sensors telemetry.Sensors
+	if in.Battery {
+		sensors |= telemetry.Battery
+	}
+	if in.AmbientLight {
+		sensors |= telemetry.AmbientLight
+	}
+	if in.TemperatureAndHumidity {
+		sensors |= telemetry.Environment
+	}
+	if in.Encoders {
+		sensors |= telemetry.Encoders
+	}
+	if sensors == 0 {
+		sensors = telemetry.All
+	}
+	snapshots, unsubscribe := s.Telemetry.Subscribe(sensors,
+		time.Duration(in.IntervalMs)*time.Millisecond)
+	defer unsubscribe()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case snapshot := <-snapshots:
+			if err := stream.Send(newTelemetry(snapshot)); err != nil {
+				return err
+			}
+		}
+	}
+}
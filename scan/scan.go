@@ -0,0 +1,201 @@
+package scan
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/dasfoo/rover/bb"
+)
+
+// Servo timing: it takes a while for the servo to reach the angle before measuring
+const (
+	StepSettle  = 50 * time.Millisecond
+	StartSettle = 500 * time.Millisecond
+)
+
+// ForwardTilt is the tilt angle in degrees at which the rangefinder looks straight ahead;
+// points within ForwardTolerance degrees from it are considered forward distance
+const (
+	ForwardTilt      = 90
+	ForwardTolerance = 10
+)
+
+// Error definitions
+var (
+	ErrInvalidStep = errors.New("Scan step must be positive")
+	ErrBusy        = errors.New("Another scan is in progress")
+	ErrNoForward   = errors.New("No forward distance has been measured during the scan")
+)
+
+// Rangefinder measures distance in centimeters, e.g. LIDAR-Lite
+type Rangefinder interface {
+	GetDistance() (uint16, error)
+}
+
+// Tilter points the rangefinder to angle in degrees, e.g. bb.BB
+type Tilter interface {
+	Tilt(angle byte) error
+}
+
+// Point of the scan profile: distance in centimeters measured at tilt angle in degrees
+type Point struct {
+	Angle    byte
+	Distance uint16
+	Time     time.Time
+}
+
+// Scanner sweeps a rangefinder mounted on the tilt servo
+type Scanner struct {
+	tilter      Tilter
+	rangefinder Rangefinder
+
+	// mu guards the fields below, and the servo and the rangefinder unless sweeping
+	mu       sync.Mutex
+	sweeping bool
+	tilted   bool
+	angle    byte
+	forward  Point
+}
+
+// NewScanner creates a Scanner for the rangefinder mounted on the tilter
+func NewScanner(tilter Tilter, rangefinder Rangefinder) *Scanner {
+	return &Scanner{
+		tilter:      tilter,
+		rangefinder: rangefinder,
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// Sweep tilts from angle "from" to "to" (both in range bb.MinTilt..bb.MaxTilt) with step,
+// measures distance at every angle and passes the point to fn. Sweep stops at the first
+// error returned by fn.
+func (s *Scanner) Sweep(ctx context.Context, from, to, step byte, fn func(Point) error) error {
+	if step == 0 {
+		return ErrInvalidStep
+	}
+	for _, angle := range []byte{from, to} {
+		if angle < bb.MinTilt || angle > bb.MaxTilt {
+			return bb.ErrAngleOutOfRange
+		}
+	}
+	s.mu.Lock()
+	if s.sweeping {
+		s.mu.Unlock()
+		return ErrBusy
+	}
+	s.sweeping = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.sweeping = false
+		s.mu.Unlock()
+	}()
+
+	settle := StartSettle
+	angle := int(from)
+	for {
+		if err := s.tilt(ctx, byte(angle), settle); err != nil {
+			return err
+		}
+		settle = StepSettle
+		point, err := s.measure()
+		if err != nil {
+			return err
+		}
+		if err = fn(point); err != nil {
+			return err
+		}
+		if angle == int(to) {
+			return nil
+		}
+		if from < to {
+			angle += int(step)
+			if angle > int(to) {
+				angle = int(to)
+			}
+		} else {
+			angle -= int(step)
+			if angle < int(to) {
+				angle = int(to)
+			}
+		}
+	}
+}
+
+// tilt moves the servo and waits for it to settle
+func (s *Scanner) tilt(ctx context.Context, angle byte, settle time.Duration) error {
+	s.mu.Lock()
+	s.tilted, s.angle = false, angle
+	s.mu.Unlock()
+	if err := s.tilter.Tilt(angle); err != nil {
+		return err
+	}
+	if err := sleep(ctx, settle); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.tilted = true
+	s.mu.Unlock()
+	return nil
+}
+
+// measure reads distance at the current angle, remembering it if it's forward
+func (s *Scanner) measure() (Point, error) {
+	distance, err := s.rangefinder.GetDistance()
+	if err != nil {
+		return Point{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	point := Point{
+		Angle:    s.angle,
+		Distance: distance,
+		Time:     time.Now(),
+	}
+	if int(point.Angle) >= ForwardTilt-ForwardTolerance &&
+		int(point.Angle) <= ForwardTilt+ForwardTolerance {
+		s.forward = point
+	}
+	return point, nil
+}
+
+// Forward returns distance straight ahead. When idle, it points the rangefinder at
+// ForwardTilt (unless it is already looking forward) and measures. During a sweep,
+// the latest forward point of the sweep is returned instead.
+func (s *Scanner) Forward(ctx context.Context) (Point, error) {
+	s.mu.Lock()
+	if s.sweeping {
+		defer s.mu.Unlock()
+		if s.forward.Time.IsZero() {
+			return Point{}, ErrNoForward
+		}
+		return s.forward, nil
+	}
+	// Block sweeps while the servo and the rangefinder are in use
+	s.sweeping = true
+	lookingForward := s.tilted && s.angle == s.forward.Angle && !s.forward.Time.IsZero()
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.sweeping = false
+		s.mu.Unlock()
+	}()
+
+	if !lookingForward {
+		if err := s.tilt(ctx, ForwardTilt, StartSettle); err != nil {
+			return Point{}, err
+		}
+	}
+	return s.measure()
+}
@@ -0,0 +1,177 @@
+package scan
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/dasfoo/rover/bb"
+)
+
+// fakeSensor is a tilt servo with a rangefinder which measures 10 times the angle
+type fakeSensor struct {
+	mu     sync.Mutex
+	angle  byte
+	angles []byte
+	err    error
+}
+
+func (f *fakeSensor) Tilt(angle byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.angle = angle
+	f.angles = append(f.angles, angle)
+	return nil
+}
+
+func (f *fakeSensor) GetDistance() (uint16, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return uint16(f.angle) * 10, f.err
+}
+
+func (f *fakeSensor) tilted() []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]byte(nil), f.angles...)
+}
+
+func TestSweep(t *testing.T) {
+	for _, test := range []struct {
+		from, to, step byte
+		want           []byte
+	}{
+		{60, 70, 5, []byte{60, 65, 70}},
+		{70, 60, 4, []byte{70, 66, 62, 60}},
+		{60, 70, 20, []byte{60, 70}},
+		{bb.MaxTilt, bb.MaxTilt, 1, []byte{bb.MaxTilt}},
+	} {
+		sensor := &fakeSensor{}
+		s := NewScanner(sensor, sensor)
+		var angles []byte
+		err := s.Sweep(context.Background(), test.from, test.to, test.step, func(p Point) error {
+			if p.Distance != uint16(p.Angle)*10 {
+				t.Errorf("Distance %d measured at %d, want it measured after tilting",
+					p.Distance, p.Angle)
+			}
+			angles = append(angles, p.Angle)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(angles, test.want) ||
+			!reflect.DeepEqual(sensor.tilted(), test.want) {
+			t.Errorf("Sweep(%d, %d, %d) measured at %v, tilted to %v, want %v",
+				test.from, test.to, test.step, angles, sensor.tilted(), test.want)
+		}
+	}
+}
+
+func TestSweepInvalid(t *testing.T) {
+	sensor := &fakeSensor{}
+	s := NewScanner(sensor, sensor)
+	for _, test := range []struct {
+		from, to, step byte
+		err            error
+	}{
+		{60, 70, 0, ErrInvalidStep},
+		{bb.MinTilt - 1, 70, 1, bb.ErrAngleOutOfRange},
+		{60, bb.MaxTilt + 1, 1, bb.ErrAngleOutOfRange},
+	} {
+		err := s.Sweep(context.Background(), test.from, test.to, test.step, func(Point) error {
+			t.Error("No point expected")
+			return nil
+		})
+		if err != test.err {
+			t.Errorf("Sweep(%d, %d, %d) = %v, want %v", test.from, test.to, test.step, err,
+				test.err)
+		}
+	}
+	if len(sensor.tilted()) != 0 {
+		t.Errorf("Invalid sweep moved the servo to %v", sensor.tilted())
+	}
+}
+
+func TestSweepStops(t *testing.T) {
+	sensor := &fakeSensor{}
+	s := NewScanner(sensor, sensor)
+	stop := errors.New("stop")
+	err := s.Sweep(context.Background(), 60, 90, 10, func(p Point) error {
+		if p.Angle == 70 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || !reflect.DeepEqual(sensor.tilted(), []byte{60, 70}) {
+		t.Errorf("Sweep stopped by fn = %v, tilted to %v", err, sensor.tilted())
+	}
+
+	sensor.err = errors.New("no signal")
+	if err = s.Sweep(context.Background(), 60, 90, 10, func(Point) error {
+		t.Error("No point expected")
+		return nil
+	}); err != sensor.err {
+		t.Errorf("Sweep with failing rangefinder = %v, want %v", err, sensor.err)
+	}
+	sensor.err = nil
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(StartSettle + StepSettle/2)
+		cancel()
+	}()
+	started := time.Now()
+	if err = s.Sweep(ctx, bb.MinTilt, bb.MaxTilt, 1, func(Point) error {
+		return nil
+	}); err != context.Canceled {
+		t.Errorf("Cancelled sweep = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(started); elapsed > StartSettle+3*StepSettle {
+		t.Errorf("Cancelled sweep took %s", elapsed)
+	}
+}
+
+func TestForwardDuringSweep(t *testing.T) {
+	sensor := &fakeSensor{}
+	s := NewScanner(sensor, sensor)
+	if _, err := s.Forward(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if tilted := sensor.tilted(); !reflect.DeepEqual(tilted, []byte{ForwardTilt}) {
+		t.Fatalf("Forward tilted to %v", tilted)
+	}
+	if _, err := s.Forward(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if tilted := sensor.tilted(); len(tilted) != 1 {
+		t.Errorf("Forward tilted again while looking forward: %v", tilted)
+	}
+
+	s = NewScanner(sensor, sensor)
+	err := s.Sweep(context.Background(), 60, 100, 20, func(p Point) error {
+		forward, err := s.Forward(context.Background())
+		if p.Angle == 60 && err != ErrNoForward {
+			t.Errorf("Forward before the sweep reached forward tilt = %v, want ErrNoForward",
+				err)
+		}
+		// Both 80 and 100 are within ForwardTolerance
+		if p.Angle >= 80 && (err != nil || forward.Angle != p.Angle) {
+			t.Errorf("Forward during sweep = %+v, %v, want the latest point at %d",
+				forward, err, p.Angle)
+		}
+		if err := s.Sweep(context.Background(), 60, 70, 1, func(Point) error {
+			return nil
+		}); err != ErrBusy {
+			t.Errorf("Concurrent sweep = %v, want ErrBusy", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
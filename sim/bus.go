@@ -0,0 +1,123 @@
+package sim
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+)
+
+// Device is a simulated i2c slave, which can be attached to the Bus
+type Device interface {
+	// Write is invoked when the master writes data (not including register) to reg
+	Write(reg byte, data []byte) error
+	// Read fills data with the bytes the device sends when the master reads from reg
+	Read(reg byte, data []byte) (int, error)
+}
+
+// Bus is an implementation of i2c.Bus which routes transactions to simulated devices
+type Bus struct {
+	mu      sync.Mutex
+	devices map[byte]Device
+	logf    func(string, ...interface{})
+}
+
+// NewBus creates a simulated bus with no devices attached
+func NewBus() *Bus {
+	return &Bus{
+		devices: make(map[byte]Device),
+		logf:    func(string, ...interface{}) {},
+	}
+}
+
+// Attach makes device d respond at address addr
+func (b *Bus) Attach(addr byte, d Device) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.devices[addr] = d
+}
+
+func (b *Bus) device(addr byte) (Device, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if d, ok := b.devices[addr]; ok {
+		return d, nil
+	}
+	return nil, fmt.Errorf("No device at address 0x%.2x", addr)
+}
+
+func (b *Bus) write(addr, reg byte, data []byte) error {
+	d, err := b.device(addr)
+	if err == nil {
+		err = d.Write(reg, data)
+	}
+	b.logf("sim: write 0x%.2x reg 0x%.2x %v: %v", addr, reg, data, err)
+	return err
+}
+
+func (b *Bus) read(addr, reg byte, data []byte) (int, error) {
+	d, err := b.device(addr)
+	var n int
+	if err == nil {
+		n, err = d.Read(reg, data)
+	}
+	b.logf("sim: read 0x%.2x reg 0x%.2x %v: %v", addr, reg, data[:n], err)
+	return n, err
+}
+
+func (b *Bus) readFull(addr, reg byte, data []byte) error {
+	n, err := b.read(addr, reg, data)
+	if err == nil && n != len(data) {
+		err = fmt.Errorf("Short read from 0x%.2x reg 0x%.2x: %d of %d bytes",
+			addr, reg, n, len(data))
+	}
+	return err
+}
+
+// SetLogger sets a function to log every transaction; silent by default
+func (b *Bus) SetLogger(logf func(string, ...interface{})) {
+	b.logf = logf
+}
+
+// ReadByteFromReg reads a single byte from the device register
+func (b *Bus) ReadByteFromReg(addr, reg byte) (byte, error) {
+	data := make([]byte, 1)
+	err := b.readFull(addr, reg, data)
+	return data[0], err
+}
+
+// ReadWordFromReg reads a word, sent by the device most significant byte first
+func (b *Bus) ReadWordFromReg(addr, reg byte) (uint16, error) {
+	data := make([]byte, 2)
+	err := b.readFull(addr, reg, data)
+	return binary.BigEndian.Uint16(data), err
+}
+
+// ReadSliceFromReg reads up to len(data) bytes from the device register
+func (b *Bus) ReadSliceFromReg(addr, reg byte, data []byte) (int, error) {
+	return b.read(addr, reg, data)
+}
+
+// WriteByteToReg writes a single byte to the device register
+func (b *Bus) WriteByteToReg(addr, reg, value byte) error {
+	return b.write(addr, reg, []byte{value})
+}
+
+// WriteWordToReg writes a word to the device register, most significant byte first
+func (b *Bus) WriteWordToReg(addr, reg byte, value uint16) error {
+	data := make([]byte, 2)
+	binary.BigEndian.PutUint16(data, value)
+	return b.write(addr, reg, data)
+}
+
+// WriteSliceToReg writes data to the device register
+func (b *Bus) WriteSliceToReg(addr, reg byte, data []byte) (int, error) {
+	if err := b.write(addr, reg, data); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// Close does nothing for the simulated bus
+func (b *Bus) Close() error {
+	return nil
+}
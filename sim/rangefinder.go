@@ -0,0 +1,25 @@
+package sim
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Rangefinder simulates a distance sensor on the tilt servo, looking at a flat floor
+type Rangefinder struct {
+	// Tilt returns the current servo angle in degrees, 90 is horizontal and less is down
+	Tilt func() byte
+	// Height of the sensor above the floor, in centimeters
+	Height float64
+	// Range is the max distance the sensor can measure, in centimeters
+	Range float64
+}
+
+// GetDistance returns distance to the floor (or Range), in centimeters, with some noise
+func (r *Rangefinder) GetDistance() (uint16, error) {
+	distance := r.Range
+	if down := (90 - float64(r.Tilt())) * math.Pi / 180; down > 0 {
+		distance = math.Min(r.Range, r.Height/math.Sin(down))
+	}
+	return uint16(distance + rand.Float64()*2), nil
+}
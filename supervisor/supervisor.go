@@ -0,0 +1,132 @@
+package supervisor
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Supervisor settings
+const (
+	// DefaultInterval between board status checks
+	DefaultInterval = time.Second
+	// MaxFailures is the number of consecutive failed status checks before reset
+	MaxFailures = 3
+	// BootTimeout is how long the board may take to boot after reset
+	BootTimeout = 5 * time.Second
+	// MinResetInterval prevents resetting the board in a loop when it doesn't recover
+	MinResetInterval = 30 * time.Second
+)
+
+// ErrZeroStatus is reported when the board doesn't have any module ready, e.g. it hangs
+var ErrZeroStatus = errors.New("Board status is empty")
+
+// Board can be checked and restored after reset, e.g. bb.BB
+type Board interface {
+	GetStatus() (uint16, error)
+	Restore(timeout time.Duration) error
+}
+
+// Health of the supervised board
+type Health struct {
+	// Resets done by the Supervisor
+	Resets int
+	// LastReset time, zero if there were no resets
+	LastReset time.Time
+	// LastResetReason is the error which triggered the last reset
+	LastResetReason error
+	// Failures is the number of consecutive failed status checks
+	Failures int
+}
+
+// Supervisor checks the board status and resets the board when it doesn't respond
+type Supervisor struct {
+	board Board
+	reset func()
+
+	mu     sync.Mutex
+	health Health
+	// ready is set once the board has reported a non-zero status
+	ready bool
+}
+
+// NewSupervisor creates a Supervisor for the board, which calls reset to reset it
+// (e.g. pulse the reset pin)
+func NewSupervisor(board Board, reset func()) *Supervisor {
+	return &Supervisor{
+		board: board,
+		reset: reset,
+	}
+}
+
+// Health returns the current board health
+func (s *Supervisor) Health() Health {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.health
+}
+
+// Check reads the board status, and resets the board if necessary
+func (s *Supervisor) Check() {
+	status, err := s.board.GetStatus()
+	if err == nil && status == 0 {
+		s.mu.Lock()
+		ready := s.ready
+		s.mu.Unlock()
+		if !ready {
+			// The board may still be booting, there's nothing to restore yet
+			return
+		}
+		err = ErrZeroStatus
+	}
+
+	if s.recordCheck(err) {
+		log.Printf("Resetting the board: %s", err)
+		s.reset()
+		if err = s.board.Restore(BootTimeout); err != nil {
+			log.Println("Failed to restore the board after reset:", err)
+			return
+		}
+		s.recordCheck(nil)
+		log.Println("The board has been restored after reset")
+	}
+}
+
+// recordCheck updates the health with the check result, and returns whether to reset
+func (s *Supervisor) recordCheck(err error) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		s.health.Failures = 0
+		s.ready = true
+		return false
+	}
+	s.health.Failures++
+	if s.health.Failures < MaxFailures && err != ErrZeroStatus {
+		return false
+	}
+	if time.Since(s.health.LastReset) < MinResetInterval {
+		return false
+	}
+	s.health.Resets++
+	s.health.LastReset = time.Now()
+	s.health.LastResetReason = err
+	return true
+}
+
+// Run checks the board every interval until ctx is done
+func (s *Supervisor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Check()
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package telemetry
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/dasfoo/rover/battery"
+	"github.com/dasfoo/rover/mc"
+	"github.com/dasfoo/rover/odometry"
+)
+
+// Sensors is a set of sensors to sample, e.g. Battery | Encoders
+type Sensors uint
+
+// Sensors available for telemetry
+const (
+	Battery Sensors = 1 << iota
+	AmbientLight
+	Environment
+	Encoders
+
+	All = Battery | AmbientLight | Environment | Encoders
+)
+
+// sensorNames are in the order sensors are reported
+var sensorNames = []struct {
+	sensor Sensors
+	name   string
+}{
+	{Battery, "battery"},
+	{AmbientLight, "ambient_light"},
+	{Environment, "environment"},
+	{Encoders, "encoders"},
+}
+
+func (s Sensors) String() string {
+	var names []string
+	for _, sensor := range sensorNames {
+		if s&sensor.sensor != 0 {
+			names = append(names, sensor.name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// Sampling limits
+const (
+	// MinInterval between snapshots sent to a subscriber
+	MinInterval = 100 * time.Millisecond
+	// EnvironmentInterval is how often temperature and humidity are actually measured,
+	// the sensor is slow and the measurement is reused for more frequent snapshots
+	EnvironmentInterval = 2 * time.Second
+)
+
+// Error definitions
+var (
+	ErrSensorDisabled = errors.New("Sensor controller is not available")
+	ErrNotMeasured    = errors.New("Sensor has not been measured yet")
+)
+
+// BatteryReader provides battery readings, e.g. battery.Monitor
+type BatteryReader interface {
+	Read() (battery.Reading, error)
+}
+
+// Board provides sensor readings, e.g. bb.BB
+type Board interface {
+	GetAmbientLight() (uint16, error)
+	GetTemperatureAndHumidity() (byte, byte, error)
+}
+
+// SensorError is a failure to read one of the sensors
+type SensorError struct {
+	Sensor Sensors
+	Err    error
+}
+
+func (e SensorError) Error() string {
+	return e.Sensor.String() + ": " + e.Err.Error()
+}
+
+// Snapshot contains readings of the sensors sampled at the same time
+type Snapshot struct {
+	Time time.Time
+	// Sensors which have been read successfully
+	Sensors Sensors
+	// Measured is when each of the Sensors has been read; it may be earlier than Time
+	// for slow sensors, which are measured less often
+	Measured map[Sensors]time.Time
+	// Errors of the sensors which have not been read, ordered by Sensors value
+	Errors []SensorError
+
+	Battery     battery.Reading
+	Light       uint16
+	Temperature byte
+	Humidity    byte
+
+	LeftFront, LeftBack, RightFront, RightBack int32
+}
+
+type subscription struct {
+	sensors  Sensors
+	interval time.Duration
+	next     time.Time
+	c        chan Snapshot
+}
+
+// Poller samples sensors for all subscribers at once, so that adding a subscriber
+// doesn't multiply i2c traffic
+type Poller struct {
+	board    Board
+	battery  BatteryReader
+	encoders odometry.EncoderReader
+
+	mu            sync.Mutex
+	subscriptions map[*subscription]struct{}
+	changed       chan struct{}
+	// environment is the latest temperature and humidity measurement
+	environment    Snapshot
+	environmentErr error
+	measuring      bool
+}
+
+// NewPoller creates a Poller for board, battery and encoders, any of which can be nil
+func NewPoller(board Board, battery BatteryReader, encoders odometry.EncoderReader) *Poller {
+	return &Poller{
+		board:         board,
+		battery:       battery,
+		encoders:      encoders,
+		subscriptions: make(map[*subscription]struct{}),
+		changed:       make(chan struct{}, 1),
+	}
+}
+
+// Subscribe starts receiving snapshots of sensors every interval (at least MinInterval).
+// Snapshots are dropped if the receiver doesn't keep up. Call the returned function to
+// unsubscribe, after which the channel is not used anymore.
+func (p *Poller) Subscribe(sensors Sensors, interval time.Duration) (<-chan Snapshot, func()) {
+	if interval < MinInterval {
+		interval = MinInterval
+	}
+	s := &subscription{
+		sensors:  sensors,
+		interval: interval,
+		next:     time.Now(),
+		c:        make(chan Snapshot, 1),
+	}
+	p.mu.Lock()
+	p.subscriptions[s] = struct{}{}
+	p.mu.Unlock()
+	p.notify()
+	return s.c, func() {
+		p.mu.Lock()
+		delete(p.subscriptions, s)
+		p.mu.Unlock()
+		p.notify()
+	}
+}
+
+func (p *Poller) notify() {
+	select {
+	case p.changed <- struct{}{}:
+	default:
+	}
+}
+
+// due returns subscriptions to be served now, and when the next one is due
+func (p *Poller) due(now time.Time) ([]*subscription, time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var (
+		due  []*subscription
+		wait = time.Duration(-1)
+	)
+	for s := range p.subscriptions {
+		if !s.next.After(now) {
+			due = append(due, s)
+			s.next = s.next.Add(s.interval)
+			if s.next.Before(now) {
+				// Skip missed snapshots rather than sending them in a burst
+				s.next = now.Add(s.interval)
+			}
+		}
+		if untilNext := s.next.Sub(now); wait < 0 || untilNext < wait {
+			wait = untilNext
+		}
+	}
+	return due, wait
+}
+
+// Run samples sensors for the subscribers until ctx is done
+func (p *Poller) Run(ctx context.Context) {
+	for {
+		due, wait := p.due(time.Now())
+		if len(due) > 0 {
+			var sensors Sensors
+			for _, s := range due {
+				sensors |= s.sensors
+			}
+			snapshot := p.sample(sensors)
+			for _, s := range due {
+				select {
+				case s.c <- filter(snapshot, s.sensors):
+				default:
+				}
+			}
+			continue
+		}
+		var timer <-chan time.Time
+		if wait >= 0 {
+			timer = time.After(wait)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.changed:
+		case <-timer:
+		}
+	}
+}
+
+func (p *Poller) sample(sensors Sensors) Snapshot {
+	snapshot := Snapshot{
+		Time:     time.Now(),
+		Measured: make(map[Sensors]time.Time),
+	}
+	errs := make(map[Sensors]error)
+	read := func(sensor Sensors, err error) {
+		if err == nil {
+			snapshot.Sensors |= sensor
+			if _, ok := snapshot.Measured[sensor]; !ok {
+				snapshot.Measured[sensor] = time.Now()
+			}
+		} else {
+			errs[sensor] = err
+		}
+	}
+	if sensors&(AmbientLight|Environment) != 0 && p.board == nil {
+		for _, sensor := range []Sensors{AmbientLight, Environment} {
+			if sensors&sensor != 0 {
+				read(sensor, ErrSensorDisabled)
+			}
+		}
+		sensors &^= AmbientLight | Environment
+	}
+	if sensors&Battery != 0 && p.battery == nil {
+		read(Battery, ErrSensorDisabled)
+		sensors &^= Battery
+	}
+	if sensors&Encoders != 0 && p.encoders == nil {
+		read(Encoders, ErrSensorDisabled)
+		sensors &^= Encoders
+	}
+
+	var err error
+	if sensors&Battery != 0 {
+		snapshot.Battery, err = p.battery.Read()
+		read(Battery, err)
+	}
+	if sensors&AmbientLight != 0 {
+		snapshot.Light, err = p.board.GetAmbientLight()
+		read(AmbientLight, err)
+	}
+	if sensors&Environment != 0 {
+		p.mu.Lock()
+		if !p.measuring && snapshot.Time.Sub(p.environment.Time) >= EnvironmentInterval {
+			p.measuring = true
+			go p.measureEnvironment()
+		}
+		environment, environmentErr := p.environment, p.environmentErr
+		p.mu.Unlock()
+		if environment.Time.IsZero() && environmentErr == nil {
+			environmentErr = ErrNotMeasured
+		}
+		snapshot.Temperature = environment.Temperature
+		snapshot.Humidity = environment.Humidity
+		if environmentErr == nil {
+			snapshot.Measured[Environment] = environment.Time
+		}
+		read(Environment, environmentErr)
+	}
+	if sensors&Encoders != 0 {
+		for _, encoder := range []struct {
+			id    byte
+			value *int32
+		}{
+			{mc.EncoderLeftFront, &snapshot.LeftFront},
+			{mc.EncoderLeftBack, &snapshot.LeftBack},
+			{mc.EncoderRightFront, &snapshot.RightFront},
+			{mc.EncoderRightBack, &snapshot.RightBack},
+		} {
+			if *encoder.value, err = p.encoders.ReadEncoder(encoder.id); err != nil {
+				break
+			}
+		}
+		read(Encoders, err)
+	}
+	for _, sensor := range sensorNames {
+		if err, ok := errs[sensor.sensor]; ok {
+			snapshot.Errors = append(snapshot.Errors, SensorError{sensor.sensor, err})
+		}
+	}
+	return snapshot
+}
+
+// measureEnvironment takes a while, so it's done in background not to delay snapshots
+func (p *Poller) measureEnvironment() {
+	t, h, err := p.board.GetTemperatureAndHumidity()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.measuring = false
+	p.environment.Time = time.Now()
+	p.environmentErr = err
+	if err == nil {
+		p.environment.Temperature, p.environment.Humidity = t, h
+	}
+}
+
+// filter leaves only sensors in the snapshot
+func filter(snapshot Snapshot, sensors Sensors) Snapshot {
+	filtered := Snapshot{
+		Time:     snapshot.Time,
+		Sensors:  snapshot.Sensors & sensors,
+		Measured: make(map[Sensors]time.Time),
+	}
+	for sensor, measured := range snapshot.Measured {
+		if sensors&sensor != 0 {
+			filtered.Measured[sensor] = measured
+		}
+	}
+	for _, err := range snapshot.Errors {
+		if sensors&err.Sensor != 0 {
+			filtered.Errors = append(filtered.Errors, err)
+		}
+	}
+	if filtered.Sensors&Battery != 0 {
+		filtered.Battery = snapshot.Battery
+	}
+	if filtered.Sensors&AmbientLight != 0 {
+		filtered.Light = snapshot.Light
+	}
+	if filtered.Sensors&Environment != 0 {
+		filtered.Temperature, filtered.Humidity = snapshot.Temperature, snapshot.Humidity
+	}
+	if filtered.Sensors&Encoders != 0 {
+		filtered.LeftFront, filtered.LeftBack = snapshot.LeftFront, snapshot.LeftBack
+		filtered.RightFront, filtered.RightBack = snapshot.RightFront, snapshot.RightBack
+	}
+	return filtered
+}
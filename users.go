@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dasfoo/rover/auth"
+)
+
+const userUsage = `Usage: %s [flags] user add|rotate [-role viewer|operator|admin] NAME
+
+Creates a user, or replaces the token of an existing one, in the backend selected by
+-auth_backend. The new token is printed; only its hash is stored. Running servers may
+accept the old token until their credentials cache expires (5 minutes).
+
+`
+
+// runUserCommand handles "rover user ..." command line to manage credentials
+func runUserCommand(args []string) error {
+	fs := flag.NewFlagSet("user", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, userUsage, os.Args[0])
+		fs.PrintDefaults()
+	}
+	role := fs.String("role", "", "Role of the user (default: "+auth.DefaultRole.String()+
+		" for add, unchanged for rotate)")
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	command := args[0]
+	_ = fs.Parse(args[1:])
+	if fs.NArg() != 1 || (command != "add" && command != "rotate") {
+		fs.Usage()
+		os.Exit(2)
+	}
+	name := fs.Arg(0)
+
+	var level auth.Level
+	if *role != "" {
+		var err error
+		if level, err = auth.ParseLevel(*role); err != nil {
+			return err
+		}
+	}
+	backend, err := newAuthBackend(true)
+	if err != nil {
+		return err
+	}
+	if backend == nil {
+		return errors.New("No credentials backend configured")
+	}
+
+	var token string
+	if command == "add" {
+		if level == 0 {
+			level = auth.DefaultRole
+		}
+		token, err = auth.AddUser(backend, name, level)
+	} else {
+		token, err = auth.RotateUser(backend, name, level)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println(token)
+	return nil
+}